@@ -0,0 +1,182 @@
+package imageupload
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+
+	"github.com/nfnt/resize"
+)
+
+// resizeGIF resizes every frame of g following plan, keeping delays and loop count.
+// Frames are composed on the full canvas following their disposal method before
+// being resized, so the result only holds full frames, each one cleared before the
+// next as its transparent pixels must not show the previous one.
+func resizeGIF(g *gif.GIF, plan fitPlan, filter resize.InterpolationFunction) *gif.GIF {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+	// Every color the frames drawn so far can have left on the canvas.
+	colors, _ := g.Config.ColorModel.(color.Palette)
+
+	out := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(g.Image)),
+		Delay:     make([]int, 0, len(g.Image)),
+		Disposal:  make([]byte, 0, len(g.Image)),
+		LoopCount: g.LoopCount,
+	}
+
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		colors = mergePalette(colors, frame.Palette)
+
+		scaled := plan.apply(canvas, filter)
+		p := image.NewPaletted(scaled.Bounds(), compositePalette(colors))
+		draw.Draw(p, p.Bounds(), scaled, scaled.Bounds().Min, draw.Src)
+
+		delay := 0
+		if i < len(g.Delay) {
+			delay = g.Delay[i]
+		}
+		out.Image = append(out.Image, p)
+		out.Delay = append(out.Delay, delay)
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return out
+}
+
+// firstFrame returns the first frame of g on the full logical screen, what the animation
+// shows first, as the frames of an animation may only cover part of the screen.
+func firstFrame(g *gif.GIF) image.Image {
+	frame := g.Image[0]
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() || frame.Bounds() == bounds {
+		return frame
+	}
+
+	// Keep the palette when it can show the uncovered area as transparent.
+	pal := withTransparent(frame.Palette)
+	if i := transparentIndex(pal); i >= 0 {
+		p := image.NewPaletted(bounds, pal)
+		for j := range p.Pix {
+			p.Pix[j] = uint8(i)
+		}
+		draw.Draw(p, frame.Bounds(), frame, frame.Bounds().Min, draw.Src)
+		return p
+	}
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Src)
+	return canvas
+}
+
+// transparentIndex returns the index of the first transparent color of p, -1 if none.
+func transparentIndex(p color.Palette) int {
+	for i, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergePalette returns p followed by the colors of q missing from p.
+func mergePalette(p, q color.Palette) color.Palette {
+	seen := make(map[color.RGBA64]bool, len(p)+len(q))
+	for _, c := range p {
+		seen[color.RGBA64Model.Convert(c).(color.RGBA64)] = true
+	}
+	merged := p
+	for _, c := range q {
+		if k := color.RGBA64Model.Convert(c).(color.RGBA64); !seen[k] {
+			seen[k] = true
+			merged = append(merged[:len(merged):len(merged)], c)
+		}
+	}
+	return merged
+}
+
+// compositePalette returns the palette of a frame composed from colors, with a transparent
+// color. Colors too many for a single GIF palette are approximated by the web safe ones.
+func compositePalette(colors color.Palette) color.Palette {
+	if p := withTransparent(colors); len(p) <= 256 && transparentIndex(p) >= 0 {
+		return p
+	}
+	return append(append(color.Palette(nil), palette.WebSafe...), color.RGBA{})
+}
+
+// withTransparent returns p with a transparent color, disposed areas would be painted otherwise
+func withTransparent(p color.Palette) color.Palette {
+	if transparentIndex(p) >= 0 || len(p) >= 256 {
+		return p
+	}
+	return append(append(color.Palette(nil), p...), color.RGBA{})
+}
+
+// gifFrames counts the frames of the GIF file data by walking its blocks, without decoding them.
+func gifFrames(data []byte) int {
+	// Header and logical screen descriptor.
+	const screenEnd = 6 + 7
+	if len(data) < screenEnd {
+		return 0
+	}
+	i := screenEnd
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << ((flags & 7) + 1)
+	}
+
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension: introducer, label, sub-blocks
+			i = skipSubBlocks(data, i+2)
+		case 0x2c: // image: descriptor, local color table, LZW code size, sub-blocks
+			if i+10 > len(data) {
+				return frames
+			}
+			frames++
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << ((flags & 7) + 1)
+			}
+			i = skipSubBlocks(data, i+1)
+		default: // trailer or garbage
+			return frames
+		}
+	}
+	return frames
+}
+
+// skipSubBlocks returns the offset following the sub-blocks starting at i.
+func skipSubBlocks(data []byte, i int) int {
+	for i < len(data) {
+		n := int(data[i])
+		i++
+		if n == 0 {
+			return i
+		}
+		i += n
+	}
+	return len(data)
+}
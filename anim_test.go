@@ -0,0 +1,189 @@
+package imageupload
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+)
+
+func TestAnimatedGIF(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(WithFormat(KeepFormat), WithStorage(storage))
+
+	p, err := u.save(bytes.NewReader(testGIFAnimation(t)), "/", "testID", "gif", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := loadGIF(t, storage, p)
+
+	if len(g.Image) != 3 {
+		t.Fatalf("expected 3 frames, got: %d", len(g.Image))
+	}
+	if g.LoopCount != 2 {
+		t.Errorf("invalid loop count, expected: 2, got: %d", g.LoopCount)
+	}
+	for i, frame := range g.Image {
+		if frame.Bounds() != image.Rect(0, 0, 4, 4) {
+			t.Errorf("invalid bounds for frame %d: %v", i, frame.Bounds())
+		}
+		if g.Delay[i] != (i+1)*10 {
+			t.Errorf("invalid delay for frame %d, expected: %d, got: %d", i, (i+1)*10, g.Delay[i])
+		}
+	}
+}
+
+func TestAnimatedGIFDisposal(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(WithFormat(KeepFormat), WithStorage(storage))
+
+	p, err := u.save(bytes.NewReader(testGIFAnimation(t)), "/", "testID", "gif", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := renderGIF(loadGIF(t, storage, p))
+
+	last := frames[2]
+	if _, _, _, a := last.At(6, 6).RGBA(); a != 0 {
+		t.Errorf("area disposed to background not cleared, got: %v", last.At(6, 6))
+	}
+	if r, _, _, _ := last.At(1, 1).RGBA(); r>>8 != 0xff {
+		t.Errorf("first frame not kept below later frames, got: %v", last.At(1, 1))
+	}
+}
+
+func TestAnimatedGIFLocalPalette(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	first := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{red})
+	second := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{blue})
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:  []*image.Paletted{first, second},
+		Delay:  []int{10, 10},
+		Config: image.Config{ColorModel: color.Palette{red}, Width: 8, Height: 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := NewMemoryStorage()
+	u := New(WithFormat(KeepFormat), WithStorage(storage))
+	p, err := u.save(bytes.NewReader(buf.Bytes()), "/", "testID", "gif", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := renderGIF(loadGIF(t, storage, p))
+
+	if got := color.RGBAModel.Convert(frames[1].At(6, 6)); got != red {
+		t.Errorf("color of a previous frame lost, expected: %v, got: %v", red, got)
+	}
+	if got := color.RGBAModel.Convert(frames[1].At(0, 0)); got != blue {
+		t.Errorf("color of the local palette lost, expected: %v, got: %v", blue, got)
+	}
+}
+
+func TestAnimatedGIFSmallFirstFrame(t *testing.T) {
+	pal := color.Palette{color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}}
+	first := image.NewPaletted(image.Rect(2, 2, 6, 6), pal)
+	second := image.NewPaletted(image.Rect(0, 0, 16, 8), pal)
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:  []*image.Paletted{first, second},
+		Delay:  []int{10, 10},
+		Config: image.Config{ColorModel: pal, Width: 16, Height: 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{KeepFormat, JPG} {
+		u := New(WithFormat(format), WithStorage(NewMemoryStorage()))
+		res, err := u.Save(bytes.NewReader(buf.Bytes()), "anim.gif", "/", "testID", Rendition{Width: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := res.Files[""]; f.Width != 8 || f.Height != 4 {
+			t.Errorf("%s: expected 8x4, got: %dx%d", format, f.Width, f.Height)
+		}
+	}
+}
+
+func TestGIFPoster(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(WithFormat(KeepFormat), WithGIFPoster(true), WithStorage(storage))
+
+	p, err := u.save(bytes.NewReader(testGIFAnimation(t)), "/", "testID", "gif", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := loadGIF(t, storage, p); len(g.Image) != 1 {
+		t.Errorf("expected a single frame, got: %d", len(g.Image))
+	}
+}
+
+// testGIFAnimation returns an 8x8 animation: a red frame, a blue square in the bottom
+// right corner disposed to background, and a green pixel in the top left corner.
+func testGIFAnimation(t *testing.T) []byte {
+	pal := color.Palette{color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}, color.RGBA{0, 0xff, 0, 0xff}}
+
+	red := image.NewPaletted(image.Rect(0, 0, 8, 8), pal)
+	blue := image.NewPaletted(image.Rect(4, 4, 8, 8), pal)
+	for i := range blue.Pix {
+		blue.Pix[i] = 1
+	}
+	green := image.NewPaletted(image.Rect(0, 0, 1, 1), pal)
+	green.Pix[0] = 2
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:     []*image.Paletted{red, blue, green},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 2,
+		Config:    image.Config{ColorModel: pal, Width: 8, Height: 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// renderGIF returns the frames of g as a decoder shows them, composed on the screen
+// following their disposal method.
+func renderGIF(g *gif.GIF) []*image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	var frames []*image.RGBA
+	for i, frame := range g.Image {
+		previous := image.NewRGBA(canvas.Bounds())
+		copy(previous.Pix, canvas.Pix)
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		shown := image.NewRGBA(canvas.Bounds())
+		copy(shown.Pix, canvas.Pix)
+		frames = append(frames, shown)
+
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+func loadGIF(t *testing.T, s Storage, name string) *gif.GIF {
+	rc, err := s.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	g, err := gif.DecodeAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
@@ -0,0 +1,284 @@
+package imageupload
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DefaultCachePrefix is where a Cache keeps derived images in its storage.
+const DefaultCachePrefix = "cache/"
+
+// DefaultMaxStoredBytes is how many bytes of images a Cache keeps in its storage by default.
+const DefaultMaxStoredBytes = 1 << 30
+
+// Cache keeps the images derived from stored ones, such as the resized variants
+// rendered by ServeHandler, so they are rendered only once. Entries are keyed by
+// image ID and transformation. Recently used ones are kept in memory up to a number
+// of bytes, and in a storage when one is given, where they survive restarts, up to
+// MaxStoredBytes. Concurrent requests for the same missing entry render it only once.
+type Cache struct {
+	// Prefix is where entries are kept in the storage, DefaultCachePrefix by default.
+	Prefix string
+
+	// MaxStoredBytes bounds the bytes of entries kept in the storage, the least recently
+	// used ones are deleted past it. It defaults to DefaultMaxStoredBytes, 0 means no limit.
+	MaxStoredBytes int64
+
+	storage  Storage
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+	calls    map[string]*cacheCall
+
+	// Entries in storage, by clean name, listed once at first use.
+	scan       sync.Once
+	storedSize int64
+	storedLRU  *list.List
+	stored     map[string]*list.Element
+}
+
+// storedEntry is an entry of the cache in storage
+type storedEntry struct {
+	name string
+	size int64
+}
+
+// cachedImage is an entry of the cache
+type cachedImage struct {
+	key    string
+	data   []byte
+	format string
+}
+
+// cacheCall is a rendering in progress, waited for by identical requests
+type cacheCall struct {
+	done chan struct{}
+	img  *cachedImage
+	err  error
+}
+
+// NewCache returns a Cache keeping up to maxBytes of images in memory and every
+// image in storage, memory only when storage is nil.
+func NewCache(maxBytes int64, storage Storage) *Cache {
+	return &Cache{
+		Prefix:         DefaultCachePrefix,
+		MaxStoredBytes: DefaultMaxStoredBytes,
+		storage:        storage,
+		maxBytes:       maxBytes,
+		lru:            list.New(),
+		entries:        make(map[string]*list.Element),
+		calls:          make(map[string]*cacheCall),
+		storedLRU:      list.New(),
+		stored:         make(map[string]*list.Element),
+	}
+}
+
+// Size returns the number of bytes of images held in memory.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Purge removes every entry derived from the image ID, from memory and storage.
+func (c *Cache) Purge(ID string) error {
+	if err := validateID(ID); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	prefix := ID + "\x00"
+	for key, e := range c.entries {
+		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
+			c.remove(e)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.storage == nil {
+		return nil
+	}
+	infos, err := c.storage.List(c.Prefix + ID + "/")
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		c.mu.Lock()
+		if e, ok := c.stored[cleanName(info.Name)]; ok {
+			c.unstore(e)
+		}
+		c.mu.Unlock()
+		if err := c.storage.Delete(info.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// get returns the entry for transformation key of the image ID, calling render
+// to produce it when it is neither in memory nor in storage.
+func (c *Cache) get(ID, key string, render func() (*cachedImage, error)) (*cachedImage, error) {
+	key = ID + "\x00" + key
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cachedImage), nil
+	}
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.img, call.err
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	c.scan.Do(c.list)
+	name := c.name(ID, key)
+	call.img = c.load(name)
+	if call.img == nil {
+		if call.img, call.err = render(); call.err == nil {
+			c.persist(name, call.img)
+		}
+	}
+	if call.img != nil {
+		call.img.key = key
+	}
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if call.err == nil {
+		c.add(call.img)
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.img, call.err
+}
+
+// name returns the name of the entry key of the image ID in storage.
+func (c *Cache) name(ID, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return c.Prefix + ID + "/" + hex.EncodeToString(sum[:16])
+}
+
+// load reads the entry name from storage, nil when missing or unreadable.
+// Entries are stored as their format name and a new line followed by the image.
+func (c *Cache) load(name string) *cachedImage {
+	if c.storage == nil {
+		return nil
+	}
+	rc, err := c.storage.Get(name)
+	if err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil
+	}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil
+	}
+	c.mu.Lock()
+	if e, ok := c.stored[cleanName(name)]; ok {
+		c.storedLRU.MoveToFront(e)
+	}
+	c.mu.Unlock()
+	return &cachedImage{format: string(data[:i]), data: data[i+1:]}
+}
+
+// persist writes img to storage as the entry name. The cache is best effort,
+// failing to write only means rendering the image again later.
+func (c *Cache) persist(name string, img *cachedImage) {
+	if c.storage == nil {
+		return
+	}
+	buf := make([]byte, 0, len(img.format)+1+len(img.data))
+	buf = append(append(append(buf, img.format...), '\n'), img.data...)
+	if err := c.storage.Put(name, bytes.NewReader(buf)); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.store(name, int64(len(buf)))
+	var evicted []string
+	for c.MaxStoredBytes > 0 && c.storedSize > c.MaxStoredBytes {
+		e := c.storedLRU.Back()
+		evicted = append(evicted, e.Value.(*storedEntry).name)
+		c.unstore(e)
+	}
+	c.mu.Unlock()
+	for _, name := range evicted {
+		c.storage.Delete(name)
+	}
+}
+
+// list indexes the entries already in storage, such as the ones of a previous run,
+// the most recently modified being the most recently used.
+func (c *Cache) list() {
+	if c.storage == nil {
+		return
+	}
+	infos, err := c.storage.List(c.Prefix)
+	if err != nil {
+		return
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime.Before(infos[j].ModTime) })
+	c.mu.Lock()
+	for _, info := range infos {
+		c.store(info.Name, info.Size)
+	}
+	c.mu.Unlock()
+}
+
+// store indexes the entry name of size bytes in storage as the most recently used.
+func (c *Cache) store(name string, size int64) {
+	name = cleanName(name)
+	if e, ok := c.stored[name]; ok {
+		c.unstore(e)
+	}
+	c.stored[name] = c.storedLRU.PushFront(&storedEntry{name: name, size: size})
+	c.storedSize += size
+}
+
+// unstore drops the entry e from the index of storage.
+func (c *Cache) unstore(e *list.Element) {
+	entry := c.storedLRU.Remove(e).(*storedEntry)
+	delete(c.stored, entry.name)
+	c.storedSize -= entry.size
+}
+
+// add keeps img in memory, evicting the least recently used entries past the limit.
+func (c *Cache) add(img *cachedImage) {
+	n := int64(len(img.data))
+	if n > c.maxBytes {
+		return
+	}
+	if e, ok := c.entries[img.key]; ok {
+		c.remove(e)
+	}
+	c.entries[img.key] = c.lru.PushFront(img)
+	c.size += n
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the entry e from memory.
+func (c *Cache) remove(e *list.Element) {
+	img := c.lru.Remove(e).(*cachedImage)
+	delete(c.entries, img.key)
+	c.size -= int64(len(img.data))
+}
@@ -0,0 +1,170 @@
+package imageupload
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheLRU(t *testing.T) {
+	c := NewCache(10, nil)
+	renders := 0
+	get := func(key string, size int) {
+		_, err := c.get("42", key, func() (*cachedImage, error) {
+			renders++
+			return &cachedImage{data: make([]byte, size), format: PNG}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get("a", 4)
+	get("b", 4)
+	get("a", 4) // a is now the most recently used
+	get("c", 4) // evicts b
+	if renders != 3 || c.Size() != 8 {
+		t.Fatalf("unexpected renders: %d, size: %d", renders, c.Size())
+	}
+	get("a", 4)
+	get("b", 4)
+	if renders != 4 {
+		t.Errorf("unexpected renders, expected b only: %d", renders)
+	}
+
+	get("big", 11)
+	if c.Size() > 10 {
+		t.Errorf("entry larger than the cache kept in memory, size: %d", c.Size())
+	}
+}
+
+func TestCacheSingleFlight(t *testing.T) {
+	c := NewCache(1<<20, nil)
+	var renders int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			img, err := c.get("42", "w=8", func() (*cachedImage, error) {
+				atomic.AddInt32(&renders, 1)
+				<-release
+				return &cachedImage{data: []byte("img"), format: PNG}, nil
+			})
+			if err != nil || string(img.data) != "img" {
+				t.Errorf("unexpected result: %v, %v", img, err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if renders != 1 {
+		t.Errorf("expected a single render, got: %d", renders)
+	}
+}
+
+func TestCacheStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	render := func() (*cachedImage, error) {
+		return &cachedImage{data: []byte("img"), format: JPG}, nil
+	}
+	if _, err := NewCache(1<<20, storage).get("42", "w=8", render); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new cache, as after a restart, finds the entry in storage.
+	c := NewCache(1<<20, storage)
+	img, err := c.get("42", "w=8", func() (*cachedImage, error) {
+		t.Error("entry rendered again")
+		return render()
+	})
+	if err != nil || string(img.data) != "img" || img.format != JPG {
+		t.Errorf("unexpected entry: %+v, %v", img, err)
+	}
+
+	if err := c.Purge("42"); err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := storage.List(DefaultCachePrefix); len(infos) != 0 || c.Size() != 0 {
+		t.Errorf("entries left after purge: %v, size: %d", infos, c.Size())
+	}
+}
+
+func TestCacheStorageEviction(t *testing.T) {
+	storage := NewMemoryStorage()
+	render := func() (*cachedImage, error) {
+		return &cachedImage{data: make([]byte, 6), format: PNG}, nil // 10 bytes stored
+	}
+	c := NewCache(0, storage)
+	c.MaxStoredBytes = 25
+	for _, key := range []string{"a", "b", "a", "c"} {
+		if _, err := c.get("42", key, render); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b is the least recently used, a was read back from storage.
+	for key, kept := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, err := storage.Stat(c.name("42", "42\x00"+key)); (err == nil) != kept {
+			t.Errorf("%s: expected kept %v, got: %v", key, kept, err)
+		}
+	}
+
+	// A new cache, as after a restart, accounts for the entries already stored.
+	c = NewCache(0, storage)
+	c.MaxStoredBytes = 25
+	if _, err := c.get("43", "d", render); err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := storage.List(DefaultCachePrefix); len(infos) != 2 {
+		t.Errorf("expected 2 entries in storage, got: %v", infos)
+	}
+}
+
+// countingStorage counts the reads of a Storage, cache entries aside.
+type countingStorage struct {
+	Storage
+	gets int32
+}
+
+func (s *countingStorage) Get(name string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(cleanName(name), DefaultCachePrefix) {
+		atomic.AddInt32(&s.gets, 1)
+	}
+	return s.Storage.Get(name)
+}
+
+func TestServeHandlerCache(t *testing.T) {
+	storage := &countingStorage{Storage: NewMemoryStorage()}
+	u := New(WithStorage(storage))
+	if _, err := u.save(bytes.NewReader(testJPGImage), "/", "42", "jpg", 0); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServeHandler(u, "/")
+	h.Cache = NewCache(1<<20, storage)
+
+	var bodies [][]byte
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/42?w=4", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+			t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+		}
+		bodies = append(bodies, w.Body.Bytes())
+	}
+	if !bytes.Equal(bodies[0], bodies[1]) || h.Cache.Size() != int64(len(bodies[0])) {
+		t.Errorf("variant not served from cache, size: %d", h.Cache.Size())
+	}
+	// The original is only read to render.
+	if storage.gets != 1 {
+		t.Errorf("unexpected reads: %d", storage.gets)
+	}
+}
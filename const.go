@@ -1,8 +1,17 @@
 package imageupload
 
-// Global Constants
+// Global Constants, the names of the built-in formats
 const (
-	GIF = 2
-	PNG = 1
-	JPG = 0
+	WEBP = "webp"
+	GIF  = "gif"
+	PNG  = "png"
+	JPG  = "jpeg"
+)
+
+// Output format policies, given to WithFormat in place of a format name
+const (
+	// KeepFormat encodes images in the format they were uploaded in.
+	KeepFormat = "keep"
+	// AutoFormat encodes images with transparency as PNG and the others as JPG.
+	AutoFormat = "auto"
 )
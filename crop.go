@@ -0,0 +1,133 @@
+package imageupload
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"net/http"
+	"strconv"
+)
+
+// ErrInvalidCrop is returned when the crop given with an upload does not fit the image.
+var ErrInvalidCrop = errors.New("invalid crop")
+
+// Crop is a rectangle chosen by the user, cut out of the upload before it is resized.
+// When the user picked it on a preview of the image, PreviewWidth and PreviewHeight
+// are the dimensions of the preview and the rectangle is scaled to the image,
+// otherwise they are 0 and the rectangle is in pixels of the image.
+// The image is turned upright, see WithAutoOrient, before it is cropped.
+type Crop struct {
+	X, Y, Width, Height         int
+	PreviewWidth, PreviewHeight int
+}
+
+// Form fields read by UploadResult for the crop, all in pixels.
+// The preview fields are optional.
+const (
+	CropXField             = "crop_x"
+	CropYField             = "crop_y"
+	CropWidthField         = "crop_width"
+	CropHeightField        = "crop_height"
+	CropPreviewWidthField  = "crop_preview_width"
+	CropPreviewHeightField = "crop_preview_height"
+)
+
+// UploadCropped reads the picture from the multi-part form of r, cuts crop out of it
+// and saves the given renditions of it, or the configured ones, like UploadResult does.
+func (u *Uploader) UploadCropped(r *http.Request, location string, ID string, crop Crop, renditions ...Rendition) (*Result, error) {
+	if len(renditions) == 0 {
+		renditions = u.renditions
+	}
+	if len(renditions) == 0 {
+		return nil, ErrNoRenditions
+	}
+
+	file, ext, err := u.formFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return u.process(file, ext, location, ID, renditions, &crop)
+}
+
+// formCrop reads the crop from the fields of the parsed form of r, nil without crop fields.
+func formCrop(r *http.Request) (*Crop, error) {
+	if r.MultipartForm == nil || len(r.MultipartForm.Value[CropWidthField]) == 0 {
+		return nil, nil
+	}
+
+	var c Crop
+	for _, f := range []struct {
+		name     string
+		dst      *int
+		optional bool
+	}{
+		{CropXField, &c.X, false},
+		{CropYField, &c.Y, false},
+		{CropWidthField, &c.Width, false},
+		{CropHeightField, &c.Height, false},
+		{CropPreviewWidthField, &c.PreviewWidth, true},
+		{CropPreviewHeightField, &c.PreviewHeight, true},
+	} {
+		s := r.FormValue(f.name)
+		if s == "" && f.optional {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %q", ErrInvalidCrop, f.name, s)
+		}
+		*f.dst = n
+	}
+	return &c, nil
+}
+
+// maxPreview is the largest preview dimension, keeping the scaling from overflowing.
+const maxPreview = 1 << 24
+
+// rect validates c against the bounds b of the image and returns the rectangle
+// to cut out, relative to the top left corner of b.
+func (c Crop) rect(b image.Rectangle) (image.Rectangle, error) {
+	w, h := b.Dx(), b.Dy()
+	pw, ph := c.PreviewWidth, c.PreviewHeight
+	if pw == 0 && ph == 0 {
+		pw, ph = w, h
+	}
+
+	if pw <= 0 || ph <= 0 || pw > maxPreview || ph > maxPreview {
+		return image.Rectangle{}, fmt.Errorf("%w: preview of %dx%d", ErrInvalidCrop, c.PreviewWidth, c.PreviewHeight)
+	}
+	if c.X < 0 || c.Y < 0 || c.Width <= 0 || c.Height <= 0 ||
+		c.Width > pw || c.Height > ph || c.X > pw-c.Width || c.Y > ph-c.Height {
+		return image.Rectangle{}, fmt.Errorf("%w: %dx%d at %d,%d out of %dx%d", ErrInvalidCrop, c.Width, c.Height, c.X, c.Y, pw, ph)
+	}
+
+	// Scale from the preview, rounding to the nearest pixel.
+	r := image.Rect(
+		(c.X*w+pw/2)/pw, (c.Y*h+ph/2)/ph,
+		((c.X+c.Width)*w+pw/2)/pw, ((c.Y+c.Height)*h+ph/2)/ph,
+	)
+	if r.Empty() {
+		return image.Rectangle{}, fmt.Errorf("%w: less than a pixel of the image", ErrInvalidCrop)
+	}
+	return r, nil
+}
+
+// cropImage returns the part r of img, relative to its top left corner, as a new image.
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min.Add(r.Min), draw.Src)
+	return dst
+}
+
+// subImage returns the part r of img, relative to its top left corner, sharing its pixels when possible.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r.Add(img.Bounds().Min))
+	}
+	return cropImage(img, r)
+}
@@ -0,0 +1,131 @@
+package imageupload
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCropRect(t *testing.T) {
+	b := image.Rect(0, 0, 400, 200)
+	testTable := []struct {
+		Crop Crop
+		Rect image.Rectangle
+		Err  bool
+	}{
+		{Crop{X: 10, Y: 20, Width: 100, Height: 50}, image.Rect(10, 20, 110, 70), false},
+		{Crop{X: 0, Y: 0, Width: 400, Height: 200}, b, false},
+		{Crop{X: 10, Y: 10, Width: 50, Height: 50, PreviewWidth: 200, PreviewHeight: 100}, image.Rect(20, 20, 120, 120), false},
+		{Crop{X: 1, Y: 1, Width: 2, Height: 2, PreviewWidth: 3, PreviewHeight: 3}, image.Rect(133, 67, 400, 200), false},
+		{Crop{X: 350, Y: 0, Width: 100, Height: 50}, image.Rectangle{}, true},
+		{Crop{X: -1, Y: 0, Width: 100, Height: 50}, image.Rectangle{}, true},
+		{Crop{X: 0, Y: 0, Width: 0, Height: 50}, image.Rectangle{}, true},
+		{Crop{X: 0, Y: 0, Width: 10, Height: 10, PreviewWidth: 100}, image.Rectangle{}, true},
+		{Crop{X: math.MaxInt, Y: 0, Width: 1, Height: 1}, image.Rectangle{}, true},
+		{Crop{X: 0, Y: 0, Width: 1, Height: 1, PreviewWidth: 10000, PreviewHeight: 10000}, image.Rectangle{}, true},
+	}
+
+	for _, tt := range testTable {
+		r, err := tt.Crop.rect(b)
+		if (err != nil) != tt.Err || r != tt.Rect {
+			t.Errorf("%+v: unexpected result: %v, %v", tt.Crop, r, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidCrop) {
+			t.Errorf("%+v: unexpected error: %v", tt.Crop, err)
+		}
+	}
+}
+
+func TestUploadCrop(t *testing.T) {
+	// Red on the left half, blue on the right half.
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if x >= 20 {
+				c = color.RGBA{0, 0, 0xff, 0xff}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := NewMemoryStorage()
+	u := New(WithStorage(storage), WithFormat(PNG))
+
+	// The right half, picked on a preview half the size.
+	r := newCropRequest(t, buf.Bytes(), map[string]string{
+		CropXField: "10", CropYField: "0", CropWidthField: "10", CropHeightField: "10",
+		CropPreviewWidthField: "20", CropPreviewHeightField: "10",
+	})
+	res, err := u.UploadResult(r, "/", "testID", Rendition{Width: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := res.Files[""]
+	if f.Width != 10 || f.Height != 10 || f.Crop == nil || *f.Crop != (Rect{X: 20, Y: 0, Width: 20, Height: 20}) {
+		t.Fatalf("unexpected file: %+v %+v", f, f.Crop)
+	}
+	rc, err := storage.Get(f.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, b, _ := img.At(5, 5).RGBA(); r > b {
+		t.Errorf("expected the blue half, got: %v", img.At(5, 5))
+	}
+
+	res, err = u.UploadCropped(newUploadRequest(t, "get_picture", "me.png", buf.Bytes()), "/", "testID", Crop{X: 0, Y: 0, Width: 20, Height: 20}, Rendition{})
+	if err != nil || *res.Files[""].Crop != (Rect{Width: 20, Height: 20}) {
+		t.Errorf("unexpected result: %+v, %v", res, err)
+	}
+
+	r = newCropRequest(t, buf.Bytes(), map[string]string{CropXField: "30", CropYField: "0", CropWidthField: "20", CropHeightField: "abc"})
+	if _, err := u.UploadResult(r, "/", "testID", Rendition{}); !errors.Is(err, ErrInvalidCrop) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r = newCropRequest(t, buf.Bytes(), map[string]string{CropXField: "30", CropYField: "0", CropWidthField: "20", CropHeightField: "20"})
+	NewUploadHandler(u, "/").ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status for a crop out of bounds: %d", w.Code)
+	}
+}
+
+// newCropRequest returns an upload request of content with the given form fields.
+func newCropRequest(t *testing.T, content []byte, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := w.CreateFormFile("get_picture", "me.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
@@ -0,0 +1,244 @@
+package imageupload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrExists is returned when saving an image over an existing one with OverwriteError.
+var ErrExists = errors.New("image already exists")
+
+// OverwritePolicy tells what happens when an image is saved under the name of an existing one.
+type OverwritePolicy int
+
+// Overwrite policies
+const (
+	// OverwriteReplace replaces the existing image, whatever its format, the default.
+	OverwriteReplace OverwritePolicy = iota
+	// OverwriteError fails with ErrExists.
+	OverwriteError
+	// OverwriteVersion saves the image next to the existing one, as ID_v2, ID_v3 and so on.
+	OverwriteVersion
+)
+
+// refsSuffix is appended to the name of content addressed files to name the list of their references.
+const refsSuffix = ".refs"
+
+// WithOverwrite sets what happens when an image is saved under the name of an existing one.
+// Checking for the existing image and saving are not atomic, concurrent uploads for
+// the same ID may both succeed.
+func WithOverwrite(policy OverwritePolicy) Option {
+	return func(u *Uploader) { u.overwrite = policy }
+}
+
+// WithContentAddressing names saved files after the SHA-256 of their content instead
+// of their ID, so identical images share a single file, ex: /users/3a7bd3e2...jpg.
+// Each file keeps the list of the images referencing it, see Release. Files are only
+// known by the path returned in the Result: Lookup and ServeHandler, which find images
+// by ID, do not find them.
+func WithContentAddressing(enabled bool) Option {
+	return func(u *Uploader) { u.contentAddressed = enabled }
+}
+
+// Release removes the reference of the image ID under location to the content
+// addressed file path, as found in a Result, and deletes the file once no image
+// references it anymore. It fails with an error satisfying errors.Is(err, os.ErrNotExist)
+// and leaves the file untouched when ID does not reference path.
+func (u *Uploader) Release(location, ID, path string) error {
+	ref, err := u.ref(location, ID)
+	if err != nil {
+		return err
+	}
+
+	u.refsMu.Lock()
+	defer u.refsMu.Unlock()
+
+	refs, err := u.readRefs(path)
+	if err != nil {
+		return err
+	}
+	kept := refs[:0]
+	for _, r := range refs {
+		if r != ref {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(refs) {
+		// Not a content addressed file, or not one of ours.
+		return fmt.Errorf("%w: %s is not referenced by %s", os.ErrNotExist, path, ref)
+	}
+	if len(kept) > 0 {
+		return u.writeRefs(path, kept)
+	}
+
+	if err := u.storage.Delete(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return &StorageError{Name: path, Err: err}
+	}
+	if err := u.storage.Delete(path + refsSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return &StorageError{Name: path + refsSuffix, Err: err}
+	}
+	return nil
+}
+
+// put writes data, the image ID encoded as f, under location following the naming,
+// overwrite and content addressing settings. It returns the name of the file and
+// whether the same content was already stored.
+func (u *Uploader) put(location, ID string, f Format, data []byte) (string, bool, error) {
+	if err := validateID(ID); err != nil {
+		return "", false, err
+	}
+	if u.contentAddressed {
+		return u.putContent(location, ID, f, data)
+	}
+
+	name, err := u.objectName(location, ID, f.ext())
+	if err != nil {
+		return "", false, err
+	}
+	if u.overwrite != OverwriteReplace {
+		for v := 2; ; v++ {
+			exists, err := u.exists(name)
+			if err != nil {
+				return "", false, &StorageError{Name: name, Err: err}
+			}
+			if !exists {
+				break
+			}
+			if u.overwrite == OverwriteError {
+				return "", false, fmt.Errorf("%w: %s", ErrExists, name)
+			}
+			if name, err = u.objectName(location, ID+"_v"+strconv.Itoa(v), f.ext()); err != nil {
+				return "", false, err
+			}
+		}
+	}
+
+	if err := u.createShards(name); err != nil {
+		return "", false, err
+	}
+	if err := u.storage.Put(name, bytes.NewReader(data)); err != nil {
+		return "", false, &StorageError{Name: name, Err: err}
+	}
+	if u.overwrite == OverwriteReplace {
+		if err := u.removeOthers(location, ID, name); err != nil {
+			return "", false, err
+		}
+	}
+	return name, false, nil
+}
+
+// removeOthers deletes the files of the image ID under location in other formats
+// than name, as left by a previous upload, so lookups by ID find the new one.
+func (u *Uploader) removeOthers(location, ID, name string) error {
+	for _, f := range registeredFormats() {
+		if f.Encode == nil {
+			continue
+		}
+		other, err := u.objectName(location, ID, f.ext())
+		if err != nil || other == name {
+			continue
+		}
+		if err := u.storage.Delete(other); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return &StorageError{Name: other, Err: err}
+		}
+	}
+	return nil
+}
+
+// putContent writes data under location, named after its hash, unless it is already
+// stored, and adds the image ID to the references of the file.
+func (u *Uploader) putContent(location, ID string, f Format, data []byte) (string, bool, error) {
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:])
+	name, err := joinPath(location, shard(key, u.shards)+key+"."+f.ext())
+	if err != nil {
+		return "", false, err
+	}
+	ref, err := u.ref(location, ID)
+	if err != nil {
+		return "", false, err
+	}
+
+	u.refsMu.Lock()
+	defer u.refsMu.Unlock()
+
+	duplicate, err := u.exists(name)
+	if err != nil {
+		return "", false, &StorageError{Name: name, Err: err}
+	}
+	if !duplicate {
+		if err := u.createShards(name); err != nil {
+			return "", false, err
+		}
+		if err := u.storage.Put(name, bytes.NewReader(data)); err != nil {
+			return "", false, &StorageError{Name: name, Err: err}
+		}
+	}
+
+	refs, err := u.readRefs(name)
+	if err != nil {
+		return "", false, err
+	}
+	for _, r := range refs {
+		if r == ref {
+			return name, duplicate, nil
+		}
+	}
+	return name, duplicate, u.writeRefs(name, append(refs, ref))
+}
+
+// ref returns the reference of the image ID under location to a content addressed file.
+func (u *Uploader) ref(location, ID string) (string, error) {
+	if err := validateID(ID); err != nil {
+		return "", err
+	}
+	return joinPath(location, ID)
+}
+
+// exists reports whether the file name is in storage.
+func (u *Uploader) exists(name string) (bool, error) {
+	_, err := u.storage.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// readRefs returns the references of the content addressed file name, one per line.
+func (u *Uploader) readRefs(name string) ([]string, error) {
+	rc, err := u.storage.Get(name + refsSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &StorageError{Name: name + refsSuffix, Err: err}
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, &StorageError{Name: name + refsSuffix, Err: err}
+	}
+	var refs []string
+	for _, r := range strings.Split(string(data), "\n") {
+		if r != "" {
+			refs = append(refs, r)
+		}
+	}
+	return refs, nil
+}
+
+// writeRefs replaces the references of the content addressed file name.
+func (u *Uploader) writeRefs(name string, refs []string) error {
+	data := strings.Join(refs, "\n") + "\n"
+	if err := u.storage.Put(name+refsSuffix, strings.NewReader(data)); err != nil {
+		return &StorageError{Name: name + refsSuffix, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package imageupload
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOverwritePolicy(t *testing.T) {
+	testTable := []struct {
+		Policy OverwritePolicy
+		Paths  []string
+		Err    error
+	}{
+		{OverwriteReplace, []string{"/testID.jpg", "/testID.jpg", "/testID.jpg"}, nil},
+		{OverwriteError, []string{"/testID.jpg", ""}, ErrExists},
+		{OverwriteVersion, []string{"/testID.jpg", "/testID_v2.jpg", "/testID_v3.jpg"}, nil},
+	}
+
+	for _, tt := range testTable {
+		u := New(WithStorage(NewMemoryStorage()), WithOverwrite(tt.Policy))
+		for i, expected := range tt.Paths {
+			p, err := u.save(bytes.NewReader(testJPGImage), "/", "testID", "jpg", 0)
+			if expected == "" {
+				if !errors.Is(err, tt.Err) {
+					t.Errorf("policy %d, upload %d: unexpected error: %v", tt.Policy, i, err)
+				}
+				continue
+			}
+			if err != nil || p != expected {
+				t.Errorf("policy %d, upload %d: unexpected path: %q, %v", tt.Policy, i, p, err)
+			}
+		}
+	}
+}
+
+func TestReplaceOtherFormat(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(WithStorage(storage), WithFormat(KeepFormat))
+	if _, err := u.save(bytes.NewReader(testJPGImage), "/u/", "42", "jpg", 0); err != nil {
+		t.Fatal(err)
+	}
+	p, err := u.save(bytes.NewReader(testPNGImage(t)), "/u/", "42", "png", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := u.Lookup("/u/", "42"); err != nil || got != p {
+		t.Errorf("previous upload found: %q, %v", got, err)
+	}
+	if _, err := storage.Stat("/u/42.jpg"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("previous upload kept: %v", err)
+	}
+}
+
+func TestContentAddressing(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(WithStorage(storage), WithContentAddressing(true))
+
+	var paths []string
+	for i, id := range []string{"alice", "bob"} {
+		res, err := u.Save(bytes.NewReader(testJPGImage), "me.jpg", "/users/", id, Rendition{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := res.Files[""]
+		if f.Duplicate != (i > 0) {
+			t.Errorf("%s: unexpected duplicate flag: %v", id, f.Duplicate)
+		}
+		paths = append(paths, f.Path)
+	}
+
+	if paths[0] != paths[1] || !strings.HasPrefix(paths[0], "/users/") || len(paths[0]) != len("/users/")+64+len(".jpg") {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+	infos, err := storage.List("users/")
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("expected the file and its references, got: %v, %v", infos, err)
+	}
+
+	if err := u.Release("/users/", "carol", paths[0]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected error releasing an unreferenced file: %v", err)
+	}
+	if err := u.Release("/users/", "alice", paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Release("/users/", "alice", paths[0]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected error releasing twice: %v", err)
+	}
+	if _, err := storage.Stat(paths[0]); err != nil {
+		t.Errorf("file deleted while still referenced: %v", err)
+	}
+	if err := u.Release("/users/", "bob", paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Stat(paths[0]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file kept without references: %v", err)
+	}
+	if infos, _ := storage.List("users/"); len(infos) != 0 {
+		t.Errorf("unexpected files left: %v", infos)
+	}
+}
+
+func TestReleaseNotContentAddressed(t *testing.T) {
+	storage := NewMemoryStorage()
+	p, err := New(WithStorage(storage)).save(bytes.NewReader(testJPGImage), "/", "victim", "jpg", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := New(WithStorage(storage), WithContentAddressing(true))
+	if err := u.Release("/", "someone", p); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := storage.Stat(p); err != nil {
+		t.Errorf("file deleted: %v", err)
+	}
+}
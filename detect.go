@@ -0,0 +1,64 @@
+package imageupload
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+)
+
+// sniffLen is the number of leading bytes inspected to detect the format.
+const sniffLen = 512
+
+// FormatError is returned when the content of an upload is not a supported image.
+// Declared is the extension taken from the file name, Detected is the format
+// found in the content, empty when the bytes do not look like any known image.
+type FormatError struct {
+	Declared string
+	Detected string
+}
+
+func (e *FormatError) Error() string {
+	detected := e.Detected
+	if detected == "" {
+		detected = "unknown"
+	}
+	return fmt.Sprintf("file is not a supported image: declared %q, detected %q", e.Declared, detected)
+}
+
+// Unwrap makes errors.Is(err, ErrFileNotSupported) hold for every FormatError.
+func (e *FormatError) Unwrap() error { return ErrFileNotSupported }
+
+// detectFormat sniffs the content of br without consuming it and returns the format
+// it holds. The declared extension is only used as a hint for which signature to try first.
+func detectFormat(br *bufio.Reader, ext string) (Format, error) {
+	head, _ := br.Peek(sniffLen)
+
+	hint, hinted := formatByExt(ext)
+	if hinted && hint.matchMagic(head) {
+		return hint, nil
+	}
+
+	for _, f := range registeredFormats() {
+		if f.matchMagic(head) {
+			return f, nil
+		}
+	}
+
+	// Let the formats registered with the image package name what we could not.
+	_, name, _ := image.DecodeConfig(bytes.NewReader(head))
+	return Format{}, &FormatError{Declared: ext, Detected: name}
+}
+
+// match reports whether head starts with magic, '?' matching any byte
+func match(magic string, head []byte) bool {
+	if len(head) < len(magic) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != head[i] && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
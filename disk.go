@@ -0,0 +1,209 @@
+package imageupload
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiskStorage implements Storage on the local file system, under Root.
+type DiskStorage struct {
+	Root string
+
+	// MkdirAll makes Put create the missing directories of the files it writes,
+	// instead of failing. The root itself is created too.
+	MkdirAll bool
+
+	// DirPerm is the permissions of the directories created by Put, 0755 when zero.
+	DirPerm os.FileMode
+
+	// FilePerm is the permissions of the files written by Put, 0644 when zero.
+	FilePerm os.FileMode
+}
+
+// NewDiskStorage returns a DiskStorage writing below root.
+func NewDiskStorage(root string) *DiskStorage {
+	return &DiskStorage{Root: root}
+}
+
+// path returns the file of name below Root. Names are cleaned as rooted paths, so
+// ".." never climbs above Root, and refused when they hold a NUL byte or a
+// backslash, which Windows would take as a separator.
+func (d *DiskStorage) path(name string) (string, error) {
+	if strings.ContainsAny(name, "\x00\\") {
+		return "", &PathError{Path: name, Reason: "NUL byte or backslash"}
+	}
+	p := filepath.Join(d.Root, filepath.FromSlash(cleanName(name)))
+	if rel, err := filepath.Rel(d.Root, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &PathError{Path: name, Reason: "outside of the root"}
+	}
+	return p, nil
+}
+
+// Put implements Storage. The content is written to a temporary file next to
+// the final one, synced to disk, then renamed over it, so a crash or an error
+// never leaves a truncated file and concurrent writes never interleave.
+func (d *DiskStorage) Put(name string, r io.Reader) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	// Same directory, hence same file system: the rename cannot fail over to a copy.
+	dir := filepath.Dir(p)
+	if d.MkdirAll {
+		if err := os.MkdirAll(dir, d.dirPerm()); err != nil {
+			return err
+		}
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(p)+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	// Temporary files are private, give the file the usual permissions.
+	if err = f.Chmod(d.filePerm()); err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// CreateDir implements DirCreator, with DirPerm permissions.
+func (d *DiskStorage) CreateDir(name string) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(p, d.dirPerm()); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// Default permissions of the directories and files written by DiskStorage.
+const (
+	defaultDirPerm  os.FileMode = 0o755
+	defaultFilePerm os.FileMode = 0o644
+)
+
+func (d *DiskStorage) dirPerm() os.FileMode {
+	if d.DirPerm == 0 {
+		return defaultDirPerm
+	}
+	return d.DirPerm
+}
+
+func (d *DiskStorage) filePerm() os.FileMode {
+	if d.FilePerm == 0 {
+		return defaultFilePerm
+	}
+	return d.FilePerm
+}
+
+// tempSuffix ends the names of the temporary files of DiskStorage.Put.
+const tempSuffix = ".tmp"
+
+// syncDir flushes the directory entries of dir, making a rename durable. It is best
+// effort: some systems, such as Windows, cannot sync directories.
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+// Get implements Storage.
+func (d *DiskStorage) Get(name string) (io.ReadCloser, error) {
+	p, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Delete implements Storage.
+func (d *DiskStorage) Delete(name string) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// Stat implements Storage.
+func (d *DiskStorage) Stat(name string) (ObjectInfo, error) {
+	p, err := d.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if fi.IsDir() {
+		return ObjectInfo{}, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return ObjectInfo{Name: cleanName(name), Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// List implements Storage.
+func (d *DiskStorage) List(prefix string) ([]ObjectInfo, error) {
+	prefix = cleanPrefix(prefix)
+
+	// Only walk the directory the prefix points into.
+	dir, err := d.path(path.Dir(prefix + "x"))
+	if err != nil {
+		return nil, err
+	}
+	var infos []ObjectInfo
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		if isTemp(fi.Name()) {
+			// Writes in progress are not objects yet.
+			return nil
+		}
+		rel, err := filepath.Rel(d.Root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			infos = append(infos, ObjectInfo{Name: name, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+		return nil
+	})
+	// Walk goes through directories in file name order, "a/b/x" before "a/b.x".
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, err
+}
+
+// isTemp reports whether the file name is a temporary file of DiskStorage.Put.
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix)
+}
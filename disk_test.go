@@ -0,0 +1,113 @@
+package imageupload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// failingReader returns data, then err.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestDiskStorageAtomicPut(t *testing.T) {
+	s := NewDiskStorage(t.TempDir())
+	if err := s.Put("42.jpg", strings.NewReader("previous")); err != nil {
+		t.Fatal(err)
+	}
+
+	errEncode := errors.New("encode failed")
+	if err := s.Put("42.jpg", &failingReader{data: []byte("trunc"), err: errEncode}); !errors.Is(err, errEncode) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readObject(t, s, "42.jpg"); got != "previous" {
+		t.Errorf("previous content altered: %q", got)
+	}
+	if err := s.Put("43.jpg", &failingReader{err: errEncode}); !errors.Is(err, errEncode) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.Stat("43.jpg"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("failed write left a file: %v", err)
+	}
+
+	entries, err := os.ReadDir(s.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+	if fi, err := os.Stat(s.Root + "/42.jpg"); err != nil || fi.Mode().Perm() != defaultFilePerm {
+		t.Errorf("unexpected permissions: %v, %v", fi.Mode(), err)
+	}
+}
+
+func TestDiskStorageConcurrentPut(t *testing.T) {
+	s := NewDiskStorage(t.TempDir())
+	contents := make([]string, 8)
+	for i := range contents {
+		contents[i] = strings.Repeat(string(rune('a'+i)), 1<<16)
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range contents {
+		wg.Add(1)
+		go func(c string) {
+			defer wg.Done()
+			if err := s.Put("42.jpg", strings.NewReader(c)); err != nil {
+				t.Error(err)
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	got := readObject(t, s, "42.jpg")
+	if len(got) != 1<<16 || strings.Count(got, got[:1]) != len(got) {
+		t.Errorf("writes interleaved")
+	}
+	if infos, err := s.List(""); err != nil || len(infos) != 1 {
+		t.Errorf("unexpected objects: %v, %v", infos, err)
+	}
+}
+
+func readObject(t *testing.T, s Storage, name string) string {
+	rc, err := s.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, rc); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDiskStorageListOrder(t *testing.T) {
+	s := NewDiskStorage(t.TempDir())
+	s.MkdirAll = true
+	for _, name := range []string{"a/b/x", "a/b.x"} {
+		if err := s.Put(name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos, err := s.List("a/")
+	if err != nil || len(infos) != 2 || infos[0].Name != "a/b.x" || infos[1].Name != "a/b/x" {
+		t.Errorf("unexpected listing: %v, %v", infos, err)
+	}
+}
@@ -0,0 +1,54 @@
+package imageupload
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the Uploader, to be checked with errors.Is.
+var (
+	// ErrNoFile is returned when the form has no file under the field of the Uploader.
+	ErrNoFile = errors.New("no file uploaded")
+	// ErrMalformedMultipart is returned when the request body is not a valid multi-part form.
+	ErrMalformedMultipart = errors.New("malformed multipart form")
+	// ErrFileNotSupported is returned when the content of the file is not a supported image.
+	ErrFileNotSupported = errors.New("file is not an image")
+	// ErrDecode is returned when the image is in a supported format but cannot be decoded.
+	ErrDecode = errors.New("cannot decode image")
+	// ErrStorage is returned when the storage fails to save an image.
+	ErrStorage = errors.New("cannot store image")
+)
+
+// DecodeError is returned when an image in a supported format cannot be decoded,
+// errors.Is(err, ErrDecode) holds for it and Err is the cause.
+type DecodeError struct {
+	Format string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode %s image: %v", e.Format, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// Is makes errors.Is(err, ErrDecode) hold for every DecodeError.
+func (e *DecodeError) Is(target error) bool { return target == ErrDecode }
+
+// StorageError is returned when the storage fails to save the image Name,
+// errors.Is(err, ErrStorage) holds for it and Err is the cause.
+type StorageError struct {
+	Name string
+	Err  error
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("cannot store %s: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *StorageError) Unwrap() error { return e.Err }
+
+// Is makes errors.Is(err, ErrStorage) hold for every StorageError.
+func (e *StorageError) Is(target error) bool { return target == ErrStorage }
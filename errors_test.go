@@ -0,0 +1,59 @@
+package imageupload
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadErrors(t *testing.T) {
+	errPut := errors.New("disk full")
+	broken := New(WithStorage(failingStorage{NewMemoryStorage(), errPut}))
+
+	notMultipart := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("nop"))
+	notMultipart.Header.Set("Content-Type", "text/plain")
+	truncated := newUploadRequest(t, "get_picture", "me.jpg", testJPGImage[:len(testJPGImage)/2])
+
+	testTable := []struct {
+		Name     string
+		Uploader *Uploader
+		Request  *http.Request
+		Err      error
+	}{
+		{"no file", defaultUploader, newUploadRequest(t, "other", "me.jpg", testJPGImage), ErrNoFile},
+		{"not multipart", defaultUploader, notMultipart, ErrMalformedMultipart},
+		{"not an image", defaultUploader, newUploadRequest(t, "get_picture", "me.txt", []byte("nop")), ErrFileNotSupported},
+		{"truncated", defaultUploader, truncated, ErrDecode},
+		{"storage", broken, newUploadRequest(t, "get_picture", "me.jpg", testJPGImage), ErrStorage},
+	}
+
+	for _, tt := range testTable {
+		p, err := tt.Uploader.Upload(tt.Request, "/", "testID", 0)
+		if !errors.Is(err, tt.Err) || p != "" {
+			t.Errorf("%s: unexpected result: %q, %v", tt.Name, p, err)
+		}
+	}
+
+	_, err := broken.Upload(newUploadRequest(t, "get_picture", "me.jpg", testJPGImage), "/", "testID", 0)
+	var se *StorageError
+	if !errors.As(err, &se) || se.Name != "/testID.jpg" || !errors.Is(err, errPut) {
+		t.Errorf("unexpected storage error: %v", err)
+	}
+
+	_, err = defaultUploader.Upload(newUploadRequest(t, "get_picture", "me.jpg", testJPGImage[:len(testJPGImage)/2]), "/", "testID", 0)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Format != JPG || de.Err == nil {
+		t.Errorf("unexpected decode error: %v", err)
+	}
+}
+
+// failingStorage is a Storage failing every Put with err.
+type failingStorage struct {
+	Storage
+	err error
+}
+
+func (s failingStorage) Put(name string, r io.Reader) error { return s.err }
@@ -0,0 +1,140 @@
+package imageupload
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// exifHeader starts the APP1 segment holding EXIF data in JPEG files.
+const exifHeader = "Exif\x00\x00"
+
+// orientationTag is the EXIF tag of the orientation, stored as a SHORT in IFD0.
+const orientationTag = 0x0112
+
+// exifOrientation reads the orientation tag from IFD0 of the TIFF structure, 0 if missing.
+func exifOrientation(tiff []byte) int {
+	order, ifd, ok := tiffHeader(tiff)
+	if !ok {
+		return 0
+	}
+	offset, ok := ifdEntry(tiff, order, ifd, orientationTag)
+	if !ok {
+		return 0
+	}
+	return int(order.Uint16(tiff[offset+8:]))
+}
+
+// tiffHeader returns the byte order of the TIFF structure and the offset of IFD0.
+func tiffHeader(tiff []byte) (binary.ByteOrder, int, bool) {
+	if len(tiff) < 8 {
+		return nil, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, 0, false
+	}
+	return order, int(order.Uint32(tiff[4:])), true
+}
+
+// ifdEntry returns the offset of the 12 byte entry for tag in the IFD at ifd.
+func ifdEntry(tiff []byte, order binary.ByteOrder, ifd int, tag uint16) (int, bool) {
+	if ifd < 0 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) == tag {
+			return entry, true
+		}
+	}
+	return 0, false
+}
+
+// orientationEXIF returns a TIFF structure holding only the orientation o.
+func orientationEXIF(o int) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	copy(tiff, "MM")
+	binary.BigEndian.PutUint16(tiff[2:], 42)
+	binary.BigEndian.PutUint32(tiff[4:], 8)
+	binary.BigEndian.PutUint16(tiff[8:], 1)
+	binary.BigEndian.PutUint16(tiff[10:], orientationTag)
+	binary.BigEndian.PutUint16(tiff[12:], 3) // SHORT
+	binary.BigEndian.PutUint32(tiff[14:], 1)
+	binary.BigEndian.PutUint16(tiff[18:], uint16(o))
+	return tiff
+}
+
+// withOrientation returns a copy of the TIFF structure with the orientation set to o, if present.
+func withOrientation(tiff []byte, o int) []byte {
+	out := append([]byte(nil), tiff...)
+	order, ifd, ok := tiffHeader(out)
+	if !ok {
+		return out
+	}
+	if entry, ok := ifdEntry(out, order, ifd, orientationTag); ok {
+		order.PutUint16(out[entry+8:], uint16(o))
+	}
+	return out
+}
+
+// applyOrientation returns img turned upright according to the EXIF orientation o:
+// 2 flips horizontally, 3 rotates by 180°, 4 flips vertically, 5 transposes,
+// 6 rotates by 90° clockwise, 7 transverses and 8 rotates by 90° counter-clockwise.
+func applyOrientation(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(b)
+		draw.Draw(src, b, img, b.Min, draw.Src)
+	}
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			s := src.PixOffset(b.Min.X+x, b.Min.Y+y)
+			d := dst.PixOffset(dx, dy)
+			copy(dst.Pix[d:d+4], src.Pix[s:s+4])
+		}
+	}
+	return dst
+}
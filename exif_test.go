@@ -0,0 +1,139 @@
+package imageupload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// a b c
+	// d e f
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i, c := range "abcdef" {
+		src.Set(i%3, i/3, color.RGBA{uint8(c), 0, 0, 0xff})
+	}
+
+	testTable := []struct {
+		Orientation int
+		Output      []string
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+	}
+
+	for _, tt := range testTable {
+		img := applyOrientation(src, tt.Orientation)
+		var rows []string
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			var row []byte
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, _, _, _ := img.At(x, y).RGBA()
+				row = append(row, byte(r>>8))
+			}
+			rows = append(rows, string(row))
+		}
+		if len(rows) != len(tt.Output) {
+			t.Errorf("orientation %d: unexpected output %v, expected %v", tt.Orientation, rows, tt.Output)
+			continue
+		}
+		for i := range rows {
+			if rows[i] != tt.Output[i] {
+				t.Errorf("orientation %d: unexpected output %v, expected %v", tt.Orientation, rows, tt.Output)
+				break
+			}
+		}
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for o := 1; o <= 8; o++ {
+			data := withEXIF(testJPGImage, testEXIF(order, o))
+			if got := readMetadata(JPG, data).orientation(); got != o {
+				t.Errorf("%v: unexpected orientation, expected: %d, got: %d", order, o, got)
+			}
+		}
+	}
+	if got := readMetadata(JPG, testJPGImage).orientation(); got != 0 {
+		t.Errorf("unexpected orientation without EXIF: %d", got)
+	}
+}
+
+func TestAutoOrient(t *testing.T) {
+	// Left half red, right half blue, stored rotated: once upright, red is on top.
+	src := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if x >= 16 {
+				c = color.RGBA{0, 0, 0xff, 0xff}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data := withEXIF(buf.Bytes(), testEXIF(binary.BigEndian, 6))
+
+	storage := NewMemoryStorage()
+	u := New(WithStorage(storage), WithQuality(100))
+	p, err := u.save(bytes.NewReader(data), "/", "testID", "jpg", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := storage.Get(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 32 {
+		t.Fatalf("image not rotated, bounds: %v", b)
+	}
+	if r, _, bl, _ := img.At(8, 4).RGBA(); r < bl {
+		t.Errorf("expected red on top, got: %v", img.At(8, 4))
+	}
+	if r, _, bl, _ := img.At(8, 28).RGBA(); r > bl {
+		t.Errorf("expected blue at the bottom, got: %v", img.At(8, 28))
+	}
+}
+
+// testEXIF returns a TIFF structure holding only the orientation tag.
+func testEXIF(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], orientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+	return tiff
+}
+
+// withEXIF inserts an APP1 segment holding tiff right after the SOI marker of jpg.
+func withEXIF(jpg, tiff []byte) []byte {
+	return withSegment(jpg, 0xe1, append([]byte(exifHeader), tiff...))
+}
@@ -0,0 +1,290 @@
+package imageupload
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// Fit tells how an image is resized to a box of a given width and height.
+type Fit string
+
+// Fit modes
+const (
+	// FitContain scales the image to fit in the box, keeping its aspect ratio.
+	FitContain Fit = "contain"
+	// FitCover scales the image to cover the box, keeping its aspect ratio, and crops what overflows.
+	FitCover Fit = "cover"
+	// FitFill stretches the image to the box.
+	FitFill Fit = "fill"
+	// FitCrop cuts the box out of the image, without scaling it.
+	FitCrop Fit = "crop"
+)
+
+// Gravity tells which part of the image is kept when cropping.
+type Gravity string
+
+// Gravities
+const (
+	GravityCenter Gravity = "center"
+	GravityTop    Gravity = "top"
+	GravityBottom Gravity = "bottom"
+	GravityLeft   Gravity = "left"
+	GravityRight  Gravity = "right"
+	// GravityEntropy keeps the most detailed part of the image, usually its subject.
+	GravityEntropy Gravity = "entropy"
+)
+
+// WithUpscale sets whether images smaller than the requested size are scaled up,
+// they are by default. Without upscaling, they keep their size and are only cropped.
+func WithUpscale(upscale bool) Option {
+	return func(u *Uploader) { u.upscale = upscale }
+}
+
+// validFit reports whether fit is a known mode, the empty mode being FitContain.
+func validFit(fit Fit) bool {
+	switch fit {
+	case "", FitContain, FitCover, FitFill, FitCrop:
+		return true
+	}
+	return false
+}
+
+// validGravity reports whether g is a known gravity, the empty one being GravityCenter.
+func validGravity(g Gravity) bool {
+	switch g {
+	case "", GravityCenter, GravityTop, GravityBottom, GravityLeft, GravityRight, GravityEntropy, GravitySmart:
+		return true
+	}
+	return false
+}
+
+// fitPlan tells how to turn an image into the requested box: it is cut to pre when
+// it is not empty, resized to width by height, then cropped to crop when it is not
+// empty. source is the part of the image kept, relative to its top left corner.
+type fitPlan struct {
+	pre           image.Rectangle
+	width, height uint
+	crop          image.Rectangle
+	source        image.Rectangle
+}
+
+// after returns p applied to the part pre of an image, relative to its top left corner.
+func (p fitPlan) after(pre image.Rectangle) fitPlan {
+	if pre.Empty() {
+		return p
+	}
+	p.pre = pre
+	if p.source.Empty() {
+		p.source = pre
+	} else {
+		p.source = p.source.Add(pre.Min)
+	}
+	return p
+}
+
+// planFit plans how to resize img to the box of width by height pixels following fit
+// and gravity. A zero width or height is computed from the other one keeping the
+// aspect ratio, img keeps its size when both are zero.
+func planFit(img image.Image, width, height uint, fit Fit, gravity Gravity, upscale bool) fitPlan {
+	b := img.Bounds()
+	sw, sh := uint(b.Dx()), uint(b.Dy())
+	if sw == 0 || sh == 0 || (width == 0 && height == 0) {
+		return fitPlan{width: sw, height: sh}
+	}
+	if width == 0 || height == 0 {
+		// A single dimension constrains the scale whatever the mode.
+		fit = FitContain
+	}
+
+	switch fit {
+	case FitFill:
+		if !upscale {
+			width, height = minUint(width, sw), minUint(height, sh)
+		}
+		return fitPlan{width: width, height: height}
+
+	case FitCrop:
+		width, height = minUint(width, sw), minUint(height, sh)
+		p := fitPlan{width: sw, height: sh}
+		p.crop = cropRect(img, b, int(width), int(height), gravity).Sub(b.Min)
+		p.source = p.crop
+		return p
+
+	case FitCover:
+		scale := math.Max(float64(width)/float64(sw), float64(height)/float64(sh))
+		if !upscale {
+			scale = math.Min(scale, 1)
+		}
+		p := fitPlan{width: scaled(sw, scale), height: scaled(sh, scale)}
+		width, height = minUint(width, p.width), minUint(height, p.height)
+		if width < p.width || height < p.height {
+			// Pick the crop on the source, scaled: small details decide the entropy.
+			src := cropRect(img, b, int(math.Round(float64(width)/scale)), int(math.Round(float64(height)/scale)), gravity)
+			x := int(math.Round(float64(src.Min.X-b.Min.X) * scale))
+			y := int(math.Round(float64(src.Min.Y-b.Min.Y) * scale))
+			x = clamp(x, 0, int(p.width-width))
+			y = clamp(y, 0, int(p.height-height))
+			p.crop = image.Rect(x, y, x+int(width), y+int(height))
+			p.source = image.Rect(
+				int(math.Round(float64(x)/scale)), int(math.Round(float64(y)/scale)),
+				int(math.Round(float64(x+int(width))/scale)), int(math.Round(float64(y+int(height))/scale)),
+			).Intersect(image.Rect(0, 0, int(sw), int(sh)))
+		}
+		return p
+	}
+
+	// FitContain
+	var scale float64
+	switch {
+	case width == 0:
+		scale = float64(height) / float64(sh)
+	case height == 0:
+		scale = float64(width) / float64(sw)
+	default:
+		scale = math.Min(float64(width)/float64(sw), float64(height)/float64(sh))
+	}
+	if !upscale {
+		scale = math.Min(scale, 1)
+	}
+	p := fitPlan{width: scaled(sw, scale), height: scaled(sh, scale)}
+	// Keep requested dimensions exact despite rounding.
+	if width != 0 && scale == float64(width)/float64(sw) {
+		p.width = width
+	}
+	if height != 0 && scale == float64(height)/float64(sh) {
+		p.height = height
+	}
+	return p
+}
+
+// size returns the dimensions of the images produced by p.
+func (p fitPlan) size() (uint, uint) {
+	if !p.crop.Empty() {
+		return uint(p.crop.Dx()), uint(p.crop.Dy())
+	}
+	return p.width, p.height
+}
+
+// apply resizes and crops img according to p.
+func (p fitPlan) apply(img image.Image, filter resize.InterpolationFunction) image.Image {
+	if !p.pre.Empty() {
+		img = cropImage(img, p.pre)
+	}
+	b := img.Bounds()
+	if uint(b.Dx()) != p.width || uint(b.Dy()) != p.height {
+		img = resize.Resize(p.width, p.height, img, filter)
+		b = img.Bounds()
+	}
+	if p.crop.Empty() {
+		return img
+	}
+	return cropImage(img, p.crop)
+}
+
+// cropRect returns the rectangle of width by height pixels within b kept by gravity.
+func cropRect(img image.Image, b image.Rectangle, width, height int, gravity Gravity) image.Rectangle {
+	width, height = clamp(width, 1, b.Dx()), clamp(height, 1, b.Dy())
+	freeX, freeY := b.Dx()-width, b.Dy()-height
+
+	x, y := freeX/2, freeY/2
+	switch gravity {
+	case GravityTop:
+		y = 0
+	case GravityBottom:
+		y = freeY
+	case GravityLeft:
+		x = 0
+	case GravityRight:
+		x = freeX
+	case GravityEntropy:
+		x, y = entropyOffset(img, b, width, height)
+	case GravitySmart:
+		x, y = smartOffset(img, b, width, height)
+	}
+	min := b.Min.Add(image.Pt(x, y))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(width, height))}
+}
+
+// entropySteps is the number of windows compared along each axis for GravityEntropy.
+const entropySteps = 16
+
+// entropyOffset returns the offset within b of the window of width by height
+// pixels with the highest entropy of luminance.
+func entropyOffset(img image.Image, b image.Rectangle, width, height int) (int, int) {
+	freeX, freeY := b.Dx()-width, b.Dy()-height
+	stepX, stepY := maxInt(1, freeX/entropySteps), maxInt(1, freeY/entropySteps)
+
+	bestX, bestY, best := freeX/2, freeY/2, -1.0
+	for y := 0; y <= freeY; y += stepY {
+		for x := 0; x <= freeX; x += stepX {
+			min := b.Min.Add(image.Pt(x, y))
+			e := entropy(img, image.Rectangle{Min: min, Max: min.Add(image.Pt(width, height))})
+			if e > best {
+				bestX, bestY, best = x, y, e
+			}
+		}
+	}
+	return bestX, bestY
+}
+
+// entropyLen is the largest number of pixels sampled in each direction to compute an entropy.
+const entropyLen = 64
+
+// entropy returns the Shannon entropy of the luminance of img within r, sampled on a grid.
+func entropy(img image.Image, r image.Rectangle) float64 {
+	stepX, stepY := maxInt(1, r.Dx()/entropyLen), maxInt(1, r.Dy()/entropyLen)
+
+	var hist [256]int
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y += stepY {
+		for x := r.Min.X; x < r.Max.X; x += stepX {
+			hist[color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y]++
+			n++
+		}
+	}
+
+	var e float64
+	for _, c := range hist {
+		if c > 0 {
+			p := float64(c) / float64(n)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// scaled returns n scaled by scale, at least 1. It rounds like resize.Resize
+// does for a missing dimension, so widths alone give the same heights as before.
+func scaled(n uint, scale float64) uint {
+	if s := uint(0.7 + float64(n)*scale); s > 0 {
+		return s
+	}
+	return 1
+}
+
+func minUint(a, b uint) uint {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
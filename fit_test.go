@@ -0,0 +1,81 @@
+package imageupload
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestPlanFit(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	testTable := []struct {
+		Width, Height uint
+		Fit           Fit
+		Gravity       Gravity
+		Upscale       bool
+		W, H          uint
+		Crop          image.Rectangle
+	}{
+		{0, 0, FitContain, "", true, 400, 200, image.Rectangle{}},
+		{100, 0, FitContain, "", true, 100, 50, image.Rectangle{}},
+		{0, 100, FitCover, "", true, 200, 100, image.Rectangle{}},
+		{100, 100, FitContain, "", true, 100, 50, image.Rectangle{}},
+		{400, 100, "", "", true, 200, 100, image.Rectangle{}},
+		{100, 100, FitFill, "", true, 100, 100, image.Rectangle{}},
+		{100, 100, FitCover, "", true, 200, 100, image.Rect(50, 0, 150, 100)},
+		{100, 100, FitCover, GravityLeft, true, 200, 100, image.Rect(0, 0, 100, 100)},
+		{100, 100, FitCover, GravityRight, true, 200, 100, image.Rect(100, 0, 200, 100)},
+		{100, 100, FitCrop, GravityTop, true, 400, 200, image.Rect(150, 0, 250, 100)},
+		{100, 100, FitCrop, GravityBottom, true, 400, 200, image.Rect(150, 100, 250, 200)},
+		{800, 0, FitContain, "", true, 800, 400, image.Rectangle{}},
+		{800, 0, FitContain, "", false, 400, 200, image.Rectangle{}},
+		{800, 800, FitFill, "", false, 400, 200, image.Rectangle{}},
+		{800, 800, FitCover, "", false, 400, 200, image.Rectangle{}},
+		{300, 300, FitCover, "", false, 400, 200, image.Rect(50, 0, 350, 200)},
+	}
+
+	for _, tt := range testTable {
+		p := planFit(img, tt.Width, tt.Height, tt.Fit, tt.Gravity, tt.Upscale)
+		if p.width != tt.W || p.height != tt.H || p.crop != tt.Crop {
+			t.Errorf("%dx%d %s %s upscale %v: unexpected plan %+v, expected %dx%d %v", tt.Width, tt.Height, tt.Fit, tt.Gravity, tt.Upscale, p, tt.W, tt.H, tt.Crop)
+		}
+	}
+}
+
+func TestGravityEntropy(t *testing.T) {
+	// A flat image with noise on its right side only.
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			c := color.RGBA{0x80, 0x80, 0x80, 0xff}
+			if x >= 200 {
+				v := uint8((x*31 + y*17) % 256)
+				c = color.RGBA{v, v, v, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	p := planFit(img, 100, 100, FitCrop, GravityEntropy, true)
+	if p.crop.Min.X < 180 {
+		t.Errorf("expected the detailed right side, got: %v", p.crop)
+	}
+}
+
+func TestSquareRendition(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 60, 40)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	u := New(WithStorage(NewMemoryStorage()))
+	res, err := u.Save(bytes.NewReader(buf.Bytes()), "me.jpg", "/", "testID", Rendition{Name: "avatar", Width: 32, Height: 32, Fit: FitCover})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := res.Files["avatar"]; f.Width != 32 || f.Height != 32 {
+		t.Errorf("unexpected avatar: %+v", f)
+	}
+}
@@ -0,0 +1,178 @@
+package imageupload
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/webp"
+)
+
+// Format describes an image format the package can decode, and encode when Encode is set.
+type Format struct {
+	// Name identifies the format, ex: "jpeg". It is what WithFormat expects.
+	Name string
+	// Extensions are matched case-insensitively against uploaded file names.
+	// The first one is given to files encoded in this format, ex: "jpg".
+	Extensions []string
+	MIMETypes  []string
+	// Magic are the signatures the content of a file starts with, '?' matches any byte.
+	Magic []string
+
+	Decode func(r io.Reader) (image.Image, error)
+	// DecodeConfig reads the dimensions from the header, the limits of an Uploader
+	// are checked with it before decoding.
+	DecodeConfig func(r io.Reader) (image.Config, error)
+	// Encode is nil for formats which can only be decoded.
+	Encode func(w io.Writer, img image.Image, opts *EncodeOptions) error
+}
+
+// EncodeOptions are the settings given to Format.Encode.
+type EncodeOptions struct {
+	// Quality ranges from 1 to 100, for lossy formats.
+	Quality int
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:         JPG,
+		Extensions:   []string{"jpg", "jpeg", "jpe"},
+		MIMETypes:    []string{"image/jpeg"},
+		Magic:        []string{"\xff\xd8\xff"},
+		Decode:       jpeg.Decode,
+		DecodeConfig: jpeg.DecodeConfig,
+		Encode:       encodeJPG,
+	})
+	RegisterFormat(Format{
+		Name:         PNG,
+		Extensions:   []string{"png"},
+		MIMETypes:    []string{"image/png"},
+		Magic:        []string{"\x89PNG\r\n\x1a\n"},
+		Decode:       png.Decode,
+		DecodeConfig: png.DecodeConfig,
+		Encode:       func(w io.Writer, img image.Image, _ *EncodeOptions) error { return png.Encode(w, img) },
+	})
+	RegisterFormat(Format{
+		Name:         GIF,
+		Extensions:   []string{"gif"},
+		MIMETypes:    []string{"image/gif"},
+		Magic:        []string{"GIF87a", "GIF89a"},
+		Decode:       gif.Decode,
+		DecodeConfig: gif.DecodeConfig,
+		Encode:       func(w io.Writer, img image.Image, _ *EncodeOptions) error { return gif.Encode(w, img, nil) },
+	})
+	RegisterFormat(Format{
+		Name:         WEBP,
+		Extensions:   []string{"webp"},
+		MIMETypes:    []string{"image/webp"},
+		Magic:        []string{"RIFF????WEBPVP8"},
+		Decode:       webp.Decode,
+		DecodeConfig: webp.DecodeConfig,
+	})
+}
+
+// RegisterFormat makes a format available to every Uploader. Registering a name
+// a second time replaces the previous format, which allows overriding the built-in
+// JPG, PNG, GIF and WEBP formats. It panics if the name is empty or a policy name,
+// or if Decode or DecodeConfig is missing.
+func RegisterFormat(f Format) {
+	if f.Name == "" || f.Name == KeepFormat || f.Name == AutoFormat {
+		panic(fmt.Sprintf("imageupload: invalid format name %q", f.Name))
+	}
+	if f.Decode == nil {
+		panic("imageupload: format " + f.Name + " has no decoder")
+	}
+	if f.DecodeConfig == nil {
+		panic("imageupload: format " + f.Name + " has no DecodeConfig")
+	}
+	exts := make([]string, len(f.Extensions))
+	for i, ext := range f.Extensions {
+		exts[i] = strings.ToLower(strings.TrimPrefix(ext, "."))
+	}
+	f.Extensions = exts
+
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	for i := range formats {
+		if formats[i].Name == f.Name {
+			formats[i] = f
+			return
+		}
+	}
+	formats = append(formats, f)
+}
+
+// LookupFormat returns the registered format called name.
+func LookupFormat(name string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// formatByExt returns the registered format using the file extension ext.
+func formatByExt(ext string) (Format, bool) {
+	ext = strings.ToLower(ext)
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// registeredFormats returns a snapshot of the registry, in registration order.
+func registeredFormats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return append([]Format(nil), formats...)
+}
+
+// ext is the extension given to files encoded in f.
+func (f Format) ext() string {
+	if len(f.Extensions) == 0 {
+		return f.Name
+	}
+	return f.Extensions[0]
+}
+
+// matchMagic reports whether head starts with one of the signatures of f.
+func (f Format) matchMagic(head []byte) bool {
+	for _, m := range f.Magic {
+		if match(m, head) {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeJPG(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	// JPEG has no alpha channel, transparent areas would turn black.
+	if !isOpaque(img) {
+		img = flatten(img, color.White)
+	}
+	var o *jpeg.Options
+	if opts != nil && opts.Quality > 0 {
+		o = &jpeg.Options{Quality: opts.Quality}
+	}
+	return jpeg.Encode(w, img, o)
+}
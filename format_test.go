@@ -0,0 +1,115 @@
+package imageupload
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+)
+
+// restoreFormats resets the registry to its current formats once t is done.
+func restoreFormats(t *testing.T) {
+	formatsMu.RLock()
+	saved := append([]Format(nil), formats...)
+	formatsMu.RUnlock()
+	t.Cleanup(func() {
+		formatsMu.Lock()
+		formats = saved
+		formatsMu.Unlock()
+	})
+}
+
+func TestRegisterFormat(t *testing.T) {
+	restoreFormats(t)
+	RegisterFormat(Format{
+		Name:       "test-gray",
+		Extensions: []string{".TGRAY"},
+		Magic:      []string{"TGRAY"},
+		Decode: func(r io.Reader) (image.Image, error) {
+			if _, err := io.ReadAll(r); err != nil {
+				return nil, err
+			}
+			img := image.NewGray(image.Rect(0, 0, 2, 2))
+			img.Set(0, 0, color.White)
+			return img, nil
+		},
+		DecodeConfig: func(r io.Reader) (image.Config, error) {
+			return image.Config{ColorModel: color.GrayModel, Width: 2, Height: 2}, nil
+		},
+		Encode: func(w io.Writer, img image.Image, _ *EncodeOptions) error {
+			_, err := io.WriteString(w, "TGRAY")
+			return err
+		},
+	})
+
+	f, ok := formatByExt("tgray")
+	if !ok || f.Name != "test-gray" {
+		t.Fatalf("format not found by extension: %+v", f)
+	}
+
+	storage := NewMemoryStorage()
+	u := New(WithFormat(KeepFormat), WithStorage(storage))
+	p, err := u.save(strings.NewReader("TGRAY..."), "/", "testID", "bin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/testID.tgray" {
+		t.Errorf("invalid file name, expected: /testID.tgray, got: %s", p)
+	}
+}
+
+func TestFormatByExtCaseInsensitive(t *testing.T) {
+	for _, ext := range []string{"jpg", "JPG", "JpEg", "jpeg"} {
+		if f, ok := formatByExt(ext); !ok || f.Name != JPG {
+			t.Errorf("unexpected format for %s: %q", ext, f.Name)
+		}
+	}
+	if _, ok := formatByExt("exe"); ok {
+		t.Errorf("unexpected format for exe")
+	}
+}
+
+func TestRegisterFormatReservedName(t *testing.T) {
+	restoreFormats(t)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a policy name to panic")
+		}
+	}()
+	RegisterFormat(Format{Name: KeepFormat, Decode: func(io.Reader) (image.Image, error) { return nil, nil }})
+}
+
+func TestRegisterFormatWithoutDecodeConfig(t *testing.T) {
+	restoreFormats(t)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a format without DecodeConfig to panic")
+		}
+	}()
+	RegisterFormat(Format{Name: "test-nodims", Decode: func(io.Reader) (image.Image, error) { return nil, nil }})
+}
+
+func TestDecodeOnlyFormat(t *testing.T) {
+	u := New(WithFormat(WEBP), WithStorage(NewMemoryStorage()))
+	_, err := u.save(bytes.NewReader(testJPGImage), "/", "testID", "jpg", 0)
+	if !errors.Is(err, ErrFileNotSupported) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRegisterFormatRestored(t *testing.T) {
+	t.Run("register", func(t *testing.T) {
+		restoreFormats(t)
+		RegisterFormat(Format{
+			Name:         "test-restored",
+			Decode:       func(io.Reader) (image.Image, error) { return nil, nil },
+			DecodeConfig: func(io.Reader) (image.Config, error) { return image.Config{}, nil },
+		})
+	})
+	if _, ok := LookupFormat("test-restored"); ok {
+		t.Errorf("format left in the registry")
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/DesmondANIMUS/imageupload
 
-require github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+go 1.19
+
+require (
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	golang.org/x/image v0.18.0
+)
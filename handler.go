@@ -0,0 +1,106 @@
+package imageupload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// UploadHandler is an http.Handler saving the pictures POSTed as multi-part forms.
+// It saves the renditions configured on Uploader, or the picture at its original
+// size when there are none, and responds 201 Created with the Result as JSON.
+// The picture is cropped first when the form has crop fields, see CropXField.
+// Errors are answered as JSON too, ex: {"error": "no file uploaded"}, with
+// 400 for bad forms, crops or IDs, 413 for too large uploads, 415 for files which are not
+// supported images, 409 for existing ones with OverwriteError and 500 otherwise.
+type UploadHandler struct {
+	// Uploader processes the uploads, the default one when nil.
+	Uploader *Uploader
+	// Location is where the pictures are saved. Ex: /users/images/
+	Location string
+	// ID names the picture of r, a random ID is used when nil or empty.
+	ID func(r *http.Request) string
+}
+
+// NewUploadHandler returns an UploadHandler saving pictures under location with u.
+func NewUploadHandler(u *Uploader, location string) *UploadHandler {
+	return &UploadHandler{Uploader: u, Location: location}
+}
+
+func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	u := h.Uploader
+	if u == nil {
+		u = defaultUploader
+	}
+	var id string
+	if h.ID != nil {
+		id = h.ID(r)
+	}
+	if id == "" {
+		var err error
+		if id, err = randomID(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	renditions := u.renditions
+	if len(renditions) == 0 {
+		renditions = []Rendition{{}}
+	}
+	res, err := u.UploadResult(r, h.Location, id, renditions...)
+	if err != nil {
+		status := errorStatus(err)
+		msg := err.Error()
+		if status == http.StatusInternalServerError {
+			// Do not leak storage details to clients.
+			msg = http.StatusText(status)
+		}
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+// errorStatus returns the HTTP status code answering err.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNoFile), errors.Is(err, ErrMalformedMultipart), errors.Is(err, ErrInvalidCrop), errors.Is(err, ErrInvalidPath):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUploadTooLarge), errors.Is(err, ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrFileNotSupported), errors.Is(err, ErrDecode):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSONError responds with status and msg as a JSON object.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// randomID returns 16 random bytes in hexadecimal.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
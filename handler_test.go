@@ -0,0 +1,69 @@
+package imageupload
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadHandler(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(WithStorage(storage), WithRenditions(Rendition{Name: "thumb", Width: 2}, Rendition{Name: "full"}))
+	h := NewUploadHandler(u, "/users/")
+	h.ID = func(r *http.Request) string { return "42" }
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newUploadRequest(t, "get_picture", "me.png", testPNGImage(t)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("unexpected status: %d, %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+
+	var res Result
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	thumb := res.Files["thumb"]
+	if res.Format != PNG || thumb.Path != "/users/42_thumb.jpg" || thumb.Width != 2 || thumb.Format != JPG {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	info, err := storage.Stat(thumb.Path)
+	if err != nil || info.Size != thumb.Bytes {
+		t.Errorf("unexpected size: %d, saved: %+v, %v", thumb.Bytes, info, err)
+	}
+	if full := res.Files["full"]; full.Width <= thumb.Width || full.Height <= thumb.Height {
+		t.Errorf("unexpected full rendition: %+v", full)
+	}
+}
+
+func TestUploadHandlerErrors(t *testing.T) {
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	testTable := []struct {
+		Name    string
+		Handler *UploadHandler
+		Request *http.Request
+		Status  int
+	}{
+		{"method", &UploadHandler{}, get, http.StatusMethodNotAllowed},
+		{"no file", &UploadHandler{}, newUploadRequest(t, "other", "me.jpg", testJPGImage), http.StatusBadRequest},
+		{"too large", NewUploadHandler(New(WithMaxUploadSize(16)), "/"), newUploadRequest(t, "get_picture", "me.jpg", testJPGImage), http.StatusRequestEntityTooLarge},
+		{"not an image", &UploadHandler{}, newUploadRequest(t, "get_picture", "me.jpg", []byte("nop")), http.StatusUnsupportedMediaType},
+		{"storage", NewUploadHandler(New(WithStorage(failingStorage{NewMemoryStorage(), ErrStorage})), "/"), newUploadRequest(t, "get_picture", "me.jpg", testJPGImage), http.StatusInternalServerError},
+	}
+
+	for _, tt := range testTable {
+		w := httptest.NewRecorder()
+		tt.Handler.ServeHTTP(w, tt.Request)
+		var body map[string]string
+		if w.Code != tt.Status {
+			t.Errorf("%s: unexpected status: %d, expected: %d", tt.Name, w.Code, tt.Status)
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["error"] == "" {
+			t.Errorf("%s: unexpected body: %v, %v", tt.Name, body, err)
+		}
+	}
+}
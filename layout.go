@@ -0,0 +1,101 @@
+package imageupload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxShardLevels is the deepest sharded layout, 256 directories per level.
+const maxShardLevels = 4
+
+// WithSharding spreads the files of each location over levels of sub-directories
+// named after the SHA-256 of their ID, two hexadecimal digits each, so no directory
+// holds millions of files. With 2 levels, 42.jpg is saved as 73/47/42.jpg.
+// The directories follow from the ID, lookups such as Lookup and ServeHandler
+// find the files by ID as before. Levels range from 0, no sharding, to 4.
+// The directories are created on demand when the storage is a DirCreator, such as
+// DiskStorage, the location itself must exist unless DiskStorage.MkdirAll is set.
+func WithSharding(levels int) Option {
+	return func(u *Uploader) { u.shards = clamp(levels, 0, maxShardLevels) }
+}
+
+// shard returns the sub-directories of key for levels of sharding, ex: "73/47/".
+func shard(key string, levels int) string {
+	if levels <= 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	digits := hex.EncodeToString(sum[:levels])
+	var b strings.Builder
+	for i := 0; i < levels; i++ {
+		b.WriteString(digits[2*i : 2*i+2])
+		b.WriteByte('/')
+	}
+	return b.String()
+}
+
+// objectName returns the name of the file of the image ID encoded as ext under location,
+// following the naming and sharding settings.
+func (u *Uploader) objectName(location, ID, ext string) (string, error) {
+	if err := validateID(ID); err != nil {
+		return "", err
+	}
+	return joinPath(location, shard(ID, u.shards)+u.naming(ID, ext))
+}
+
+// createShards creates the shard directories of the file name, the last directories
+// of its path, when the storage needs them.
+func (u *Uploader) createShards(name string) error {
+	dc, ok := u.storage.(DirCreator)
+	if !ok || u.shards == 0 {
+		return nil
+	}
+	dirs := make([]string, u.shards)
+	dir := path.Dir(name)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dirs[i] = dir
+		dir = path.Dir(dir)
+	}
+	for _, dir := range dirs {
+		if err := dc.CreateDir(dir); err != nil {
+			return &StorageError{Name: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the path of the file saved for the image ID under location,
+// whatever its format, or an error satisfying errors.Is(err, os.ErrNotExist).
+// Files named after their content, see WithContentAddressing, are not found.
+func (u *Uploader) Lookup(location, ID string) (string, error) {
+	name, _, _, err := u.find(location, ID)
+	return name, err
+}
+
+// find looks for the file saved for the image ID under location in every format
+// the uploader can save to.
+func (u *Uploader) find(location, ID string) (string, Format, ObjectInfo, error) {
+	for _, f := range registeredFormats() {
+		if f.Encode == nil {
+			// Never saved in a format we cannot encode.
+			continue
+		}
+		name, err := u.objectName(location, ID, f.ext())
+		if err != nil {
+			return "", Format{}, ObjectInfo{}, err
+		}
+		info, err := u.storage.Stat(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", Format{}, ObjectInfo{}, err
+		}
+		return name, f, info, nil
+	}
+	return "", Format{}, ObjectInfo{}, &os.PathError{Op: "lookup", Path: ID, Err: os.ErrNotExist}
+}
@@ -0,0 +1,105 @@
+package imageupload
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShard(t *testing.T) {
+	testTable := []struct {
+		Key      string
+		Levels   int
+		Expected string
+	}{
+		{"42", 0, ""},
+		{"42", 1, "73/"},
+		{"42", 2, "73/47/"},
+		{"43", 2, "44/cb/"},
+	}
+
+	for _, tt := range testTable {
+		if got := shard(tt.Key, tt.Levels); got != tt.Expected {
+			t.Errorf("%q, %d levels: expected %q, got %q", tt.Key, tt.Levels, tt.Expected, got)
+		}
+	}
+}
+
+func TestSharding(t *testing.T) {
+	s := NewDiskStorage(t.TempDir())
+	if err := os.Mkdir(filepath.Join(s.Root, "users"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	u := New(WithStorage(s), WithSharding(2), WithFormat(KeepFormat))
+
+	p, err := u.save(bytes.NewReader(testPNGImage(t)), "/users/", "42", "png", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/users/73/47/42.png" {
+		t.Errorf("unexpected path: %q", p)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, "users", "73", "47", "42.png")); err != nil {
+		t.Error(err)
+	}
+
+	if got, err := u.Lookup("/users/", "42"); err != nil || got != p {
+		t.Errorf("unexpected lookup: %q, %v", got, err)
+	}
+	if _, err := u.Lookup("/users/", "43"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected error for a missing image: %v", err)
+	}
+	if _, err := u.Lookup("/users/", "../42"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("unexpected error for an invalid ID: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	NewServeHandler(u, "/users/").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/42", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("unexpected response: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestShardingWithRoot(t *testing.T) {
+	dir := t.TempDir()
+	u := New(WithRoot(dir), WithSharding(2))
+	p, err := u.save(bytes.NewReader(testJPGImage), "/", "42", "jpg", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p))); err != nil {
+		t.Error(err)
+	}
+
+	// Only the shard directories are created, not the location.
+	if _, err := u.save(bytes.NewReader(testJPGImage), "/users/", "42", "jpg", 0); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing location created: %v", err)
+	}
+	if s := u.storage.(*DiskStorage); s.MkdirAll {
+		t.Errorf("storage settings changed")
+	}
+}
+
+func TestDiskStorageMkdirAll(t *testing.T) {
+	s := NewDiskStorage(filepath.Join(t.TempDir(), "images"))
+	if err := s.Put("ab/cd/42.jpg", bytes.NewReader(testJPGImage)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing directories created: %v", err)
+	}
+
+	s.MkdirAll = true
+	s.DirPerm = 0o700
+	s.FilePerm = 0o600
+	if err := s.Put("ab/cd/42.jpg", bytes.NewReader(testJPGImage)); err != nil {
+		t.Fatal(err)
+	}
+	for name, perm := range map[string]os.FileMode{"ab": 0o700, "ab/cd": 0o700, "ab/cd/42.jpg": 0o600} {
+		fi, err := os.Stat(filepath.Join(s.Root, filepath.FromSlash(name)))
+		if err != nil || fi.Mode().Perm() != perm {
+			t.Errorf("%s: unexpected permissions: %v, %v", name, fi.Mode(), err)
+		}
+	}
+}
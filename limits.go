@@ -0,0 +1,121 @@
+package imageupload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Default limits of an Uploader, enough for the photos of any phone.
+const (
+	DefaultMaxPixels     = 64 << 20
+	DefaultMaxFrames     = 500
+	DefaultMaxUploadSize = 32 << 20
+	DefaultMaxMemory     = 8 << 20
+)
+
+// ErrImageTooLarge is returned for images exceeding the limits of the Uploader.
+var ErrImageTooLarge = errors.New("image is too large")
+
+// ErrUploadTooLarge is returned for request bodies larger than the maximum upload size,
+// handlers usually answer it with 413 Request Entity Too Large.
+var ErrUploadTooLarge = errors.New("upload is too large")
+
+// LimitError describes an image exceeding the limits of the Uploader,
+// errors.Is(err, ErrImageTooLarge) holds for it.
+type LimitError struct {
+	Width, Height int
+	Frames        int
+}
+
+func (e *LimitError) Error() string {
+	if e.Frames > 0 {
+		return fmt.Sprintf("image is too large: %dx%d pixels, %d frames", e.Width, e.Height, e.Frames)
+	}
+	return fmt.Sprintf("image is too large: %dx%d pixels", e.Width, e.Height)
+}
+
+// Unwrap makes errors.Is(err, ErrImageTooLarge) hold for every LimitError.
+func (e *LimitError) Unwrap() error { return ErrImageTooLarge }
+
+// WithMaxDimensions sets the largest width and height of uploaded images, 0 means no limit.
+func WithMaxDimensions(width, height int) Option {
+	return func(u *Uploader) { u.maxWidth, u.maxHeight = width, height }
+}
+
+// WithMaxPixels sets the largest number of pixels of uploaded images, 0 means no limit.
+// The pixels of animations are counted over all their frames. It defaults to DefaultMaxPixels.
+func WithMaxPixels(pixels int64) Option {
+	return func(u *Uploader) { u.maxPixels = pixels }
+}
+
+// WithMaxFrames sets the largest number of frames of animated uploads, 0 means no limit.
+// It defaults to DefaultMaxFrames.
+func WithMaxFrames(frames int) Option {
+	return func(u *Uploader) { u.maxFrames = frames }
+}
+
+// WithMaxUploadSize sets the largest request body accepted in bytes, 0 means no limit.
+// It defaults to DefaultMaxUploadSize.
+func WithMaxUploadSize(size int64) Option {
+	return func(u *Uploader) { u.maxUploadSize = size }
+}
+
+// WithMaxMemory sets how many bytes of the multi-part form are kept in memory,
+// the rest is stored in temporary files. It defaults to DefaultMaxMemory.
+func WithMaxMemory(size int64) Option {
+	return func(u *Uploader) { u.maxMemory = size }
+}
+
+// limitBody caps the body of r to the maximum upload size of the uploader.
+func (u *Uploader) limitBody(r *http.Request) error {
+	if u.maxUploadSize <= 0 {
+		return nil
+	}
+	// Refuse announced oversized bodies without reading them.
+	if r.ContentLength > u.maxUploadSize {
+		return ErrUploadTooLarge
+	}
+	// Without the ResponseWriter the connection is not closed past the limit,
+	// the server drains or drops the rest of the body as for any unread body.
+	r.Body = http.MaxBytesReader(nil, r.Body, u.maxUploadSize)
+	return nil
+}
+
+// uploadError turns the errors of reading a body past its maximum size into ErrUploadTooLarge.
+func uploadError(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return ErrUploadTooLarge
+	}
+	return err
+}
+
+// checkLimits reads the dimensions declared by data, a file in format f, and checks
+// them against the limits of the uploader, without decoding the image. The pixels of
+// animations are counted over all their frames, each one is decoded on the full screen.
+func (u *Uploader) checkLimits(f Format, data []byte) error {
+	cfg, err := f.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return &DecodeError{Format: f.Name, Err: err}
+	}
+
+	e := &LimitError{Width: cfg.Width, Height: cfg.Height}
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if f.Name == GIF {
+		e.Frames = gifFrames(data)
+		if e.Frames > 1 {
+			pixels *= int64(e.Frames)
+		}
+	}
+
+	switch {
+	case u.maxWidth > 0 && cfg.Width > u.maxWidth,
+		u.maxHeight > 0 && cfg.Height > u.maxHeight,
+		u.maxPixels > 0 && pixels > u.maxPixels,
+		u.maxFrames > 0 && e.Frames > u.maxFrames:
+		return e
+	}
+	return nil
+}
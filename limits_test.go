@@ -0,0 +1,94 @@
+package imageupload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	testTable := []struct {
+		Name    string
+		Options []Option
+		Data    []byte
+		Err     bool
+	}{
+		{"default", nil, testJPGImage, false},
+		{"width", []Option{WithMaxDimensions(8, 0)}, testJPGImage, true},
+		{"height", []Option{WithMaxDimensions(0, 8)}, testJPGImage, true},
+		{"pixels", []Option{WithMaxPixels(64)}, testJPGImage, true},
+		{"frames", []Option{WithMaxFrames(2)}, testGIFAnimation(t), true},
+		{"enough frames", []Option{WithMaxFrames(3)}, testGIFAnimation(t), false},
+		{"frame pixels", []Option{WithMaxPixels(8 * 8 * 2)}, testGIFAnimation(t), true},
+		{"enough frame pixels", []Option{WithMaxPixels(8 * 8 * 3)}, testGIFAnimation(t), false},
+		{"no limit", []Option{WithMaxPixels(0), WithMaxFrames(0)}, testGIFAnimation(t), false},
+	}
+
+	for _, tt := range testTable {
+		u := New(append([]Option{WithStorage(NewMemoryStorage())}, tt.Options...)...)
+		_, err := u.save(bytes.NewReader(tt.Data), "/", "testID", "", 0)
+		if got := errors.Is(err, ErrImageTooLarge); got != tt.Err {
+			t.Errorf("%s: unexpected error: %v", tt.Name, err)
+		}
+		var le *LimitError
+		if tt.Err && !errors.As(err, &le) {
+			t.Errorf("%s: expected a LimitError, got: %T", tt.Name, err)
+		}
+	}
+}
+
+func TestLimitsBeforeDecode(t *testing.T) {
+	// A png header declaring a huge image, without the pixels to back it.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	data[16], data[17], data[18], data[19] = 0, 1, 0, 0 // width 65536
+	data[20], data[21], data[22], data[23] = 0, 1, 0, 0 // height 65536
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	u := New(WithStorage(NewMemoryStorage()))
+	_, err := u.save(bytes.NewReader(data), "/", "testID", "png", 0)
+	var le *LimitError
+	if !errors.As(err, &le) || le.Width != 65536 || le.Height != 65536 {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGIFFrames(t *testing.T) {
+	if n := gifFrames(testGIFAnimation(t)); n != 3 {
+		t.Errorf("unexpected frame count, expected: 3, got: %d", n)
+	}
+	if n := gifFrames([]byte("GIF89a")); n != 0 {
+		t.Errorf("unexpected frame count for a truncated file: %d", n)
+	}
+}
+
+func TestMaxUploadSize(t *testing.T) {
+	u := New(WithStorage(NewMemoryStorage()), WithMaxUploadSize(int64(len(testJPGImage))))
+
+	r := newUploadRequest(t, "get_picture", "me.jpg", testJPGImage)
+	if _, err := u.Upload(r, "/", "testID", 0); err != ErrUploadTooLarge {
+		t.Errorf("announced body: unexpected error: %v", err)
+	}
+
+	// Without Content-Length the limit is enforced while reading.
+	r = newUploadRequest(t, "get_picture", "me.jpg", testJPGImage)
+	r.ContentLength = -1
+	if _, err := u.Upload(r, "/", "testID", 0); err != ErrUploadTooLarge {
+		t.Errorf("streamed body: unexpected error: %v", err)
+	}
+
+	u = New(WithStorage(NewMemoryStorage()), WithMaxUploadSize(1<<20), WithMaxMemory(16))
+	r = newUploadRequest(t, "get_picture", "me.jpg", testJPGImage)
+	r.ContentLength = -1
+	if p, err := u.Upload(r, "/", "testID", 0); err != nil || p != "/testID.jpg" {
+		t.Errorf("unexpected result: %q, %v", p, err)
+	}
+	r.MultipartForm.RemoveAll()
+}
@@ -0,0 +1,90 @@
+package imageupload
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage implements Storage in memory, it is mostly useful in tests.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject)}
+}
+
+// Put implements Storage.
+func (m *MemoryStorage) Put(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[cleanName(name)] = memoryObject{data: data, modTime: time.Now()}
+	return nil
+}
+
+// Get implements Storage.
+func (m *MemoryStorage) Get(name string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[cleanName(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "get", Path: name, Err: os.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// Delete implements Storage.
+func (m *MemoryStorage) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := cleanName(name)
+	if _, ok := m.objects[key]; !ok {
+		return &os.PathError{Op: "delete", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+// Stat implements Storage.
+func (m *MemoryStorage) Stat(name string) (ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key := cleanName(name)
+	obj, ok := m.objects[key]
+	if !ok {
+		return ObjectInfo{}, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return ObjectInfo{Name: key, Size: int64(len(obj.data)), ModTime: obj.modTime}, nil
+}
+
+// List implements Storage.
+func (m *MemoryStorage) List(prefix string) ([]ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	prefix = cleanPrefix(prefix)
+	var infos []ObjectInfo
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, ObjectInfo{Name: key, Size: int64(len(obj.data)), ModTime: obj.modTime})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
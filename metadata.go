@@ -0,0 +1,426 @@
+package imageupload
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// MetadataPolicy tells which metadata of an upload is written to the saved files.
+// Images are always re-encoded, so nothing reaches storage unless the policy keeps it.
+type MetadataPolicy int
+
+const (
+	// MetadataStrip removes every metadata, it is the default.
+	MetadataStrip MetadataPolicy = iota
+	// MetadataKeepSafe keeps the orientation and the color profile only.
+	MetadataKeepSafe
+	// MetadataKeepAll keeps every metadata the output format can hold, GPS location included.
+	MetadataKeepAll
+)
+
+// Kinds of metadata listed in a MetadataReport.
+const (
+	MetaEXIF        = "exif"
+	MetaGPS         = "gps"
+	MetaOrientation = "orientation"
+	MetaICC         = "icc"
+	MetaXMP         = "xmp"
+	MetaIPTC        = "iptc"
+	MetaComment     = "comment"
+	MetaText        = "text"
+)
+
+// MetadataReport tells which kinds of metadata were found in an upload, and which
+// were kept in or removed from the saved files. Kinds are the Meta constants,
+// MetaGPS and MetaOrientation being parts of MetaEXIF reported on their own.
+type MetadataReport struct {
+	Found   []string `json:"found"`
+	Kept    []string `json:"kept"`
+	Removed []string `json:"removed"`
+}
+
+// WithMetadata sets which metadata of uploads is kept in the saved files.
+func WithMetadata(policy MetadataPolicy) Option {
+	return func(u *Uploader) { u.metadata = policy }
+}
+
+const (
+	gpsTag     = 0x8825
+	iccHeader  = "ICC_PROFILE\x00"
+	xmpHeader  = "http://ns.adobe.com/xap/1.0/\x00"
+	iptcHeader = "Photoshop 3.0\x00"
+	xmpKeyword = "XML:com.adobe.xmp"
+
+	// maxSegment is the largest payload of a JPEG segment.
+	maxSegment = 0xffff - 2
+)
+
+// metadata is what an upload carries besides its pixels.
+type metadata struct {
+	exif     []byte // TIFF structure, without the JPEG "Exif" header
+	icc      []byte // uncompressed ICC profile
+	xmp      []byte
+	iptc     []byte // Photoshop APP13 payload, header included
+	comments [][]byte
+	text     [][]byte // PNG text chunks, type followed by data
+}
+
+// readMetadata extracts the metadata of data, a file in the format called format.
+func readMetadata(format string, data []byte) *metadata {
+	m := &metadata{}
+	switch format {
+	case JPG:
+		m.readJPEG(data)
+	case PNG:
+		m.readPNG(data)
+	case WEBP:
+		m.readWEBP(data)
+	}
+	return m
+}
+
+func (m *metadata) readJPEG(data []byte) {
+	icc := map[byte][]byte{}
+	jpegSegments(data, func(marker byte, payload []byte) {
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(payload, []byte(exifHeader)):
+			m.exif = payload[len(exifHeader):]
+		case marker == 0xe1 && bytes.HasPrefix(payload, []byte(xmpHeader)):
+			m.xmp = payload[len(xmpHeader):]
+		case marker == 0xe2 && bytes.HasPrefix(payload, []byte(iccHeader)) && len(payload) > len(iccHeader)+2:
+			// Profiles are split in chunks numbered from 1.
+			icc[payload[len(iccHeader)]] = payload[len(iccHeader)+2:]
+		case marker == 0xed && bytes.HasPrefix(payload, []byte(iptcHeader)):
+			m.iptc = payload
+		case marker == 0xfe:
+			m.comments = append(m.comments, payload)
+		}
+	})
+	for seq := byte(1); icc[seq] != nil; seq++ {
+		m.icc = append(m.icc, icc[seq]...)
+	}
+}
+
+func (m *metadata) readPNG(data []byte) {
+	pngChunks(data, func(typ string, chunk []byte) {
+		switch typ {
+		case "eXIf":
+			m.exif = chunk
+		case "iCCP":
+			// Profile name, NUL, compression method, zlib stream.
+			i := bytes.IndexByte(chunk, 0)
+			if i < 0 || i+2 > len(chunk) {
+				return
+			}
+			if zr, err := zlib.NewReader(bytes.NewReader(chunk[i+2:])); err == nil {
+				m.icc, _ = io.ReadAll(io.LimitReader(zr, 1<<24))
+			}
+		case "iTXt":
+			// Keyword, NUL, compression flag, compression method, language, NUL, translated keyword, NUL, text.
+			if bytes.HasPrefix(chunk, []byte(xmpKeyword+"\x00\x00")) {
+				rest := chunk[len(xmpKeyword)+3:]
+				for n := 0; n < 2; n++ {
+					i := bytes.IndexByte(rest, 0)
+					if i < 0 {
+						return
+					}
+					rest = rest[i+1:]
+				}
+				m.xmp = rest
+				return
+			}
+			m.text = append(m.text, append([]byte(typ), chunk...))
+		case "tEXt":
+			if bytes.HasPrefix(chunk, []byte("Comment\x00")) {
+				m.comments = append(m.comments, chunk[len("Comment\x00"):])
+				return
+			}
+			fallthrough
+		case "zTXt":
+			m.text = append(m.text, append([]byte(typ), chunk...))
+		}
+	})
+}
+
+func (m *metadata) readWEBP(data []byte) {
+	if len(data) < 12 {
+		return
+	}
+	for i := 12; i+8 <= len(data); {
+		typ := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size
+		if size < 0 || end > len(data) {
+			return
+		}
+		chunk := data[i+8 : end]
+		switch typ {
+		case "EXIF":
+			m.exif = bytes.TrimPrefix(chunk, []byte(exifHeader))
+		case "ICCP":
+			m.icc = chunk
+		case "XMP ":
+			m.xmp = chunk
+		}
+		// Chunks are padded to an even size.
+		i = end + size%2
+	}
+}
+
+// orientation returns the EXIF orientation, 0 when there is none.
+func (m *metadata) orientation() int {
+	if m.exif == nil {
+		return 0
+	}
+	return exifOrientation(m.exif)
+}
+
+// kinds lists the kinds of metadata found.
+func (m *metadata) kinds() []string {
+	var kinds []string
+	if m.exif != nil {
+		kinds = append(kinds, MetaEXIF)
+		if order, ifd, ok := tiffHeader(m.exif); ok {
+			if _, ok := ifdEntry(m.exif, order, ifd, gpsTag); ok {
+				kinds = append(kinds, MetaGPS)
+			}
+		}
+		if m.orientation() != 0 {
+			kinds = append(kinds, MetaOrientation)
+		}
+	}
+	if m.icc != nil {
+		kinds = append(kinds, MetaICC)
+	}
+	if m.xmp != nil {
+		kinds = append(kinds, MetaXMP)
+	}
+	if m.iptc != nil {
+		kinds = append(kinds, MetaIPTC)
+	}
+	if len(m.comments) > 0 {
+		kinds = append(kinds, MetaComment)
+	}
+	if len(m.text) > 0 {
+		kinds = append(kinds, MetaText)
+	}
+	return kinds
+}
+
+// writeMetadata adds to encoded, a file in the format called format, the metadata of m
+// kept by policy and supported by the format. rotated tells whether the pixels were
+// already turned upright, the orientation is then reset. It reports what was kept.
+func writeMetadata(format string, encoded []byte, m *metadata, policy MetadataPolicy, rotated bool) ([]byte, MetadataReport) {
+	report := MetadataReport{Found: m.kinds()}
+
+	keep := &metadata{}
+	switch policy {
+	case MetadataKeepSafe:
+		if o := m.orientation(); o != 0 {
+			if rotated {
+				o = 1
+			}
+			keep.exif = orientationEXIF(o)
+		}
+		keep.icc = m.icc
+	case MetadataKeepAll:
+		keep = &metadata{exif: m.exif, icc: m.icc, xmp: m.xmp, iptc: m.iptc, comments: m.comments, text: m.text}
+		if keep.exif != nil && rotated {
+			keep.exif = withOrientation(keep.exif, 1)
+		}
+	}
+
+	var out []byte
+	var written []string
+	switch format {
+	case JPG:
+		out, written = writeJPEGMetadata(encoded, keep)
+	case PNG:
+		out, written = writePNGMetadata(encoded, keep)
+	default:
+		out = encoded
+	}
+
+	if contains(written, MetaEXIF) {
+		if policy == MetadataKeepSafe {
+			// The EXIF written is a fresh one only holding the orientation.
+			for i, k := range written {
+				if k == MetaEXIF {
+					written[i] = MetaOrientation
+				}
+			}
+		} else {
+			written = append(written, MetaGPS, MetaOrientation)
+		}
+	}
+	for _, k := range report.Found {
+		if contains(written, k) {
+			report.Kept = append(report.Kept, k)
+		} else {
+			report.Removed = append(report.Removed, k)
+		}
+	}
+	return out, report
+}
+
+// writeJPEGMetadata inserts the segments holding m right after the SOI marker of jpg.
+func writeJPEGMetadata(jpg []byte, m *metadata) ([]byte, []string) {
+	var segs bytes.Buffer
+	var written []string
+	add := func(marker byte, kind string, parts ...[]byte) {
+		n := 0
+		for _, p := range parts {
+			n += len(p)
+		}
+		if n > maxSegment {
+			return
+		}
+		segs.Write([]byte{0xff, marker, byte((n + 2) >> 8), byte(n + 2)})
+		for _, p := range parts {
+			segs.Write(p)
+		}
+		if !contains(written, kind) {
+			written = append(written, kind)
+		}
+	}
+
+	if m.exif != nil {
+		add(0xe1, MetaEXIF, []byte(exifHeader), m.exif)
+	}
+	if m.xmp != nil {
+		add(0xe1, MetaXMP, []byte(xmpHeader), m.xmp)
+	}
+	if m.icc != nil {
+		chunk := maxSegment - len(iccHeader) - 2
+		count := (len(m.icc) + chunk - 1) / chunk
+		if count < 256 {
+			for seq := 0; seq < count; seq++ {
+				end := (seq + 1) * chunk
+				if end > len(m.icc) {
+					end = len(m.icc)
+				}
+				add(0xe2, MetaICC, []byte(iccHeader), []byte{byte(seq + 1), byte(count)}, m.icc[seq*chunk:end])
+			}
+		}
+	}
+	if m.iptc != nil {
+		add(0xed, MetaIPTC, m.iptc)
+	}
+	for _, c := range m.comments {
+		add(0xfe, MetaComment, c)
+	}
+
+	if segs.Len() == 0 || len(jpg) < 2 {
+		return jpg, written
+	}
+	out := make([]byte, 0, len(jpg)+segs.Len())
+	out = append(out, jpg[:2]...)
+	out = append(out, segs.Bytes()...)
+	return append(out, jpg[2:]...), written
+}
+
+// writePNGMetadata inserts the chunks holding m right after the IHDR chunk of img.
+func writePNGMetadata(img []byte, m *metadata) ([]byte, []string) {
+	var chunks bytes.Buffer
+	var written []string
+	add := func(typ, kind string, data []byte) {
+		writePNGChunk(&chunks, typ, data)
+		if !contains(written, kind) {
+			written = append(written, kind)
+		}
+	}
+
+	if m.icc != nil {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(m.icc)
+		zw.Close()
+		add("iCCP", MetaICC, append([]byte("ICC Profile\x00\x00"), z.Bytes()...))
+	}
+	if m.exif != nil {
+		add("eXIf", MetaEXIF, m.exif)
+	}
+	if m.xmp != nil {
+		add("iTXt", MetaXMP, append([]byte(xmpKeyword+"\x00\x00\x00\x00\x00"), m.xmp...))
+	}
+	for _, c := range m.comments {
+		add("tEXt", MetaComment, append([]byte("Comment\x00"), c...))
+	}
+	for _, t := range m.text {
+		if len(t) > 4 {
+			add(string(t[:4]), MetaText, t[4:])
+		}
+	}
+
+	// Signature, then IHDR: length, type, 13 bytes of data and CRC.
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	if chunks.Len() == 0 || len(img) < ihdrEnd {
+		return img, written
+	}
+	out := make([]byte, 0, len(img)+chunks.Len())
+	out = append(out, img[:ihdrEnd]...)
+	out = append(out, chunks.Bytes()...)
+	return append(out, img[ihdrEnd:]...), written
+}
+
+func writePNGChunk(w *bytes.Buffer, typ string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	w.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	w.WriteString(typ)
+	w.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	w.Write(n[:])
+}
+
+// jpegSegments calls fn with every segment of the JPEG file data before the image data.
+func jpegSegments(data []byte, fn func(marker byte, payload []byte)) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return
+		}
+		marker := data[i+1]
+		// Metadata segments all come before the start of scan.
+		if marker == 0xda || marker == 0xd9 {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return
+		}
+		fn(marker, data[i+4:end])
+		i = end
+	}
+}
+
+// pngChunks calls fn with every chunk of the PNG file data.
+func pngChunks(data []byte, fn func(typ string, chunk []byte)) {
+	for i := 8; i+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(data) {
+			return
+		}
+		fn(string(data[i+4:i+8]), data[i+8:i+8+n])
+		i = end
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
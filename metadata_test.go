@@ -0,0 +1,98 @@
+package imageupload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataPolicy(t *testing.T) {
+	icc := bytes.Repeat([]byte("icc-profile"), 10)
+	src := withSegment(withSegment(withEXIF(testJPGImage, testGPSEXIF(6)), 0xe2, append([]byte(iccHeader), append([]byte{1, 1}, icc...)...)), 0xfe, []byte("shot by me"))
+	found := []string{MetaEXIF, MetaGPS, MetaOrientation, MetaICC, MetaComment}
+
+	testTable := []struct {
+		Policy  MetadataPolicy
+		Format  string
+		Kept    []string
+		Removed []string
+		Saved   []string
+	}{
+		{MetadataStrip, JPG, nil, found, nil},
+		{MetadataKeepSafe, JPG, []string{MetaOrientation, MetaICC}, []string{MetaEXIF, MetaGPS, MetaComment}, []string{MetaEXIF, MetaOrientation, MetaICC}},
+		{MetadataKeepAll, JPG, found, nil, found},
+		{MetadataKeepSafe, PNG, []string{MetaOrientation, MetaICC}, []string{MetaEXIF, MetaGPS, MetaComment}, []string{MetaEXIF, MetaOrientation, MetaICC}},
+		{MetadataKeepAll, PNG, found, nil, found},
+		{MetadataKeepAll, GIF, nil, found, nil},
+	}
+
+	for _, tt := range testTable {
+		storage := NewMemoryStorage()
+		u := New(WithStorage(storage), WithMetadata(tt.Policy), WithFormat(tt.Format))
+		res, err := u.Save(bytes.NewReader(src), "me.jpg", "/", "testID", Rendition{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := res.Metadata
+		if !reflect.DeepEqual(r.Found, found) || !reflect.DeepEqual(r.Kept, tt.Kept) || !reflect.DeepEqual(r.Removed, tt.Removed) {
+			t.Errorf("policy %d, %s: unexpected report: %+v", tt.Policy, tt.Format, r)
+		}
+
+		rc, err := storage.Get(res.Files[""].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(rc)
+		rc.Close()
+
+		if _, _, err := image.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("policy %d, %s: saved file is broken: %v", tt.Policy, tt.Format, err)
+		}
+		m := readMetadata(tt.Format, buf.Bytes())
+		if got := m.kinds(); !reflect.DeepEqual(got, tt.Saved) {
+			t.Errorf("policy %d, %s: unexpected metadata in saved file: %v", tt.Policy, tt.Format, got)
+		}
+		if tt.Kept != nil && m.orientation() != 1 {
+			t.Errorf("policy %d, %s: orientation not reset after rotation: %d", tt.Policy, tt.Format, m.orientation())
+		}
+		if contains(tt.Kept, MetaICC) && !bytes.Equal(m.icc, icc) {
+			t.Errorf("policy %d, %s: color profile altered", tt.Policy, tt.Format)
+		}
+	}
+}
+
+// testGPSEXIF returns a TIFF structure holding the orientation and a GPS IFD pointer.
+func testGPSEXIF(orientation int) []byte {
+	order := binary.LittleEndian
+	tiff := make([]byte, 8+2+2*12+4)
+	copy(tiff, "II")
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+
+	order.PutUint16(tiff[10:], orientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	order.PutUint16(tiff[22:], gpsTag)
+	order.PutUint16(tiff[24:], 4) // LONG
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint32(tiff[30:], 0)
+	return tiff
+}
+
+// withSegment inserts a segment right after the SOI marker of jpg.
+func withSegment(jpg []byte, marker byte, payload []byte) []byte {
+	seg := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+
+	out := append([]byte(nil), jpg[:2]...)
+	out = append(out, seg...)
+	out = append(out, payload...)
+	return append(out, jpg[2:]...)
+}
@@ -0,0 +1,102 @@
+package imageupload
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrInvalidPath is returned for IDs, locations and names which could write outside
+// of the storage root or which file systems refuse.
+var ErrInvalidPath = errors.New("invalid path")
+
+// PathError describes an invalid path, errors.Is(err, ErrInvalidPath) holds for it.
+type PathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("invalid path %q: %s", e.Path, e.Reason)
+}
+
+// Unwrap makes errors.Is(err, ErrInvalidPath) hold for every PathError.
+func (e *PathError) Unwrap() error { return ErrInvalidPath }
+
+// validateID checks that ID can be used as a single file name.
+func validateID(ID string) error {
+	if ID == "" {
+		return &PathError{Path: ID, Reason: "empty ID"}
+	}
+	if strings.ContainsAny(ID, "/") {
+		return &PathError{Path: ID, Reason: "ID holds a separator"}
+	}
+	return validateElem(ID, ID)
+}
+
+// validateElem checks a single element of p, a name without separator.
+func validateElem(p, elem string) error {
+	switch {
+	case elem == "." || elem == "..":
+		return &PathError{Path: p, Reason: "traversal"}
+	case strings.ContainsAny(elem, "\\:"):
+		return &PathError{Path: p, Reason: "Windows separator or volume"}
+	case strings.HasSuffix(elem, ".") || strings.HasSuffix(elem, " "):
+		return &PathError{Path: p, Reason: "trailing dot or space"}
+	case reservedName(elem):
+		return &PathError{Path: p, Reason: "reserved name"}
+	}
+	for _, c := range elem {
+		if c < 0x20 || c == 0x7f {
+			return &PathError{Path: p, Reason: "control character"}
+		}
+	}
+	return nil
+}
+
+// reservedName reports whether elem is a device name on Windows, such as NUL or
+// COM1, with or without extension.
+func reservedName(elem string) bool {
+	base := strings.ToUpper(elem)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	switch base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) {
+		return base[3] >= '1' && base[3] <= '9'
+	}
+	return false
+}
+
+// validatePath checks every element of the slash separated p, empty elements aside.
+func validatePath(p string) error {
+	for _, elem := range strings.Split(p, "/") {
+		if elem == "" {
+			continue
+		}
+		if err := validateElem(p, elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinPath joins location and name with a single slash, after rejecting traversal,
+// control characters and reserved names in both. A location without trailing slash
+// is a directory all the same, a leading slash is kept.
+func joinPath(location, name string) (string, error) {
+	if err := validatePath(location); err != nil {
+		return "", err
+	}
+	if err := validatePath(name); err != nil {
+		return "", err
+	}
+	if location == "" {
+		return path.Clean(name), nil
+	}
+	return path.Join(location, name), nil
+}
@@ -0,0 +1,82 @@
+package imageupload
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJoinPath(t *testing.T) {
+	testTable := []struct {
+		Location, Name string
+		Output         string
+		Err            bool
+	}{
+		{"/", "testID.jpg", "/testID.jpg", false},
+		{"", "testID.jpg", "testID.jpg", false},
+		{"/users/", "testID.jpg", "/users/testID.jpg", false},
+		{"/users", "testID.jpg", "/users/testID.jpg", false},
+		{"users//images/", "testID.jpg", "users/images/testID.jpg", false},
+		{"/users/../../etc/", "testID.jpg", "", true},
+		{"/users/", "../testID.jpg", "", true},
+		{"C:/users/", "testID.jpg", "", true},
+		{"/users/", "a\\b.jpg", "", true},
+		{"/users/", "a\x00.jpg", "", true},
+		{"/users/", "CON.jpg", "", true},
+		{"/com1/", "testID.jpg", "", true},
+		{"/users/", "console.jpg", "/users/console.jpg", false},
+	}
+
+	for _, tt := range testTable {
+		p, err := joinPath(tt.Location, tt.Name)
+		if p != tt.Output || (err != nil) != tt.Err {
+			t.Errorf("%q + %q: unexpected result: %q, %v", tt.Location, tt.Name, p, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q + %q: unexpected error: %v", tt.Location, tt.Name, err)
+		}
+	}
+}
+
+func TestInvalidIDs(t *testing.T) {
+	u := New(WithStorage(NewMemoryStorage()))
+	for _, id := range []string{"", ".", "..", "../../etc/cron.d/x", "/abs", "a/b", "nul", "lpt9.txt", "x\x00", "x\n", "x."} {
+		_, err := u.save(bytes.NewReader(testJPGImage), "/", id, "jpg", 0)
+		var pe *PathError
+		if !errors.Is(err, ErrInvalidPath) || !errors.As(err, &pe) {
+			t.Errorf("%q: unexpected error: %v", id, err)
+		}
+	}
+
+	p, err := u.save(bytes.NewReader(testJPGImage), "/users", "abc", "jpg", 0)
+	if err != nil || p != "/users/abc.jpg" {
+		t.Errorf("location without trailing slash: %q, %v", p, err)
+	}
+}
+
+func TestDiskStorageRoot(t *testing.T) {
+	root := t.TempDir()
+	s := NewDiskStorage(filepath.Join(root, "images"))
+	if err := os.Mkdir(s.Root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a\\..\\..\\x.jpg", "x\x00.jpg"} {
+		if err := s.Put(name, bytes.NewReader(nil)); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: unexpected error: %v", name, err)
+		}
+	}
+
+	// Traversal is cleaned as a rooted path and stays below Root.
+	if err := s.Put("../../x.jpg", bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, "x.jpg")); err != nil {
+		t.Errorf("file not written below root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "x.jpg")); !os.IsNotExist(err) {
+		t.Errorf("file written outside of root: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package imageupload
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/nfnt/resize"
+)
+
+// Hash is a 64 bit perceptual hash, similar images have hashes at a small Hamming distance.
+type Hash uint64
+
+// Distance returns the Hamming distance between h and o, the number of bits they differ by.
+func (h Hash) Distance(o Hash) int {
+	return bits.OnesCount64(uint64(h ^ o))
+}
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// MarshalText encodes h as 16 hexadecimal digits.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes h from hexadecimal digits.
+func (h *Hash) UnmarshalText(text []byte) error {
+	n, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return err
+	}
+	*h = Hash(n)
+	return nil
+}
+
+// PerceptualHashes are the perceptual hashes of an image. They survive resizing
+// and re-compression: AHash compares pixels to the mean, DHash to their neighbour
+// and PHash, the most robust, compares the low frequencies of the image.
+type PerceptualHashes struct {
+	AHash Hash `json:"ahash"`
+	DHash Hash `json:"dhash"`
+	PHash Hash `json:"phash"`
+}
+
+// WithPerceptualHashes sets whether the perceptual hashes of uploads are computed
+// and returned in their Result.
+func WithPerceptualHashes(enabled bool) Option {
+	return func(u *Uploader) { u.hashes = enabled }
+}
+
+// ComputeHashes returns the perceptual hashes of img.
+func ComputeHashes(img image.Image) PerceptualHashes {
+	return PerceptualHashes{
+		AHash: averageHash(img),
+		DHash: differenceHash(img),
+		PHash: perceptionHash(img),
+	}
+}
+
+// averageHash sets a bit for each pixel of img reduced to 8x8 brighter than the mean.
+func averageHash(img image.Image) Hash {
+	g := grayPixels(img, 8, 8)
+	var sum float64
+	for _, v := range g {
+		sum += v
+	}
+	mean := sum / float64(len(g))
+
+	var h Hash
+	for _, v := range g {
+		h <<= 1
+		if v > mean {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// differenceHash sets a bit for each pixel of img reduced to 9x8 brighter than its right neighbour.
+func differenceHash(img image.Image) Hash {
+	g := grayPixels(img, 9, 8)
+	var h Hash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if g[y*9+x] > g[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// perceptionHash sets a bit for each of the 8x8 lowest frequencies of the discrete
+// cosine transform of img reduced to 32x32 above their median.
+func perceptionHash(img image.Image) Hash {
+	const n, low = 32, 8
+	g := grayPixels(img, n, n)
+	coeffs := dct2(g, n)
+
+	var lows []float64
+	for y := 0; y < low; y++ {
+		lows = append(lows, coeffs[y*n:y*n+low]...)
+	}
+	// The first coefficient is the mean brightness, it would skew the median.
+	sorted := append([]float64(nil), lows[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var h Hash
+	for _, v := range lows {
+		h <<= 1
+		if v > median {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// grayPixels returns the luminance of img resized to w by h, row by row.
+func grayPixels(img image.Image, w, h int) []float64 {
+	small := resize.Resize(uint(w), uint(h), img, resize.Bilinear)
+	b := small.Bounds()
+	g := make([]float64, 0, w*h)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g = append(g, float64(color.GrayModel.Convert(small.At(x, y)).(color.Gray).Y))
+		}
+	}
+	return g
+}
+
+// dct2 returns the two dimensional DCT-II of the n by n values v.
+func dct2(v []float64, n int) []float64 {
+	cos := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cos[k*n+i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+
+	// Rows, then columns.
+	tmp := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for k := 0; k < n; k++ {
+			var s float64
+			for i := 0; i < n; i++ {
+				s += v[y*n+i] * cos[k*n+i]
+			}
+			tmp[y*n+k] = s
+		}
+	}
+	out := make([]float64, n*n)
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var s float64
+			for i := 0; i < n; i++ {
+				s += tmp[i*n+x] * cos[k*n+i]
+			}
+			out[k*n+x] = s
+		}
+	}
+	return out
+}
+
+// HashIndex is an in-memory index of the perceptual hashes of images, safe for
+// concurrent use, to find the images similar to a given one.
+type HashIndex struct {
+	mu     sync.RWMutex
+	hashes map[string]PerceptualHashes
+}
+
+// Match is an image found in a HashIndex, Distance is the distance of its PHash.
+type Match struct {
+	ID       string
+	Distance int
+}
+
+// NewHashIndex returns an empty HashIndex.
+func NewHashIndex() *HashIndex {
+	return &HashIndex{hashes: make(map[string]PerceptualHashes)}
+}
+
+// Add indexes the hashes of the image ID, replacing previous ones.
+func (x *HashIndex) Add(ID string, h PerceptualHashes) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.hashes[ID] = h
+}
+
+// Remove drops the image ID from the index.
+func (x *HashIndex) Remove(ID string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.hashes, ID)
+}
+
+// Len returns the number of images in the index.
+func (x *HashIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.hashes)
+}
+
+// Search returns the images whose PHash is at most maxDistance from the one of h,
+// closest first. A distance up to 10 usually means the same picture.
+func (x *HashIndex) Search(h PerceptualHashes, maxDistance int) []Match {
+	x.mu.RLock()
+	var matches []Match
+	for id, o := range x.hashes {
+		if d := h.PHash.Distance(o.PHash); d <= maxDistance {
+			matches = append(matches, Match{ID: id, Distance: d})
+		}
+	}
+	x.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	return matches
+}
@@ -0,0 +1,111 @@
+package imageupload
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/nfnt/resize"
+)
+
+// testPattern returns a w by h image of smooth waves with a bright disc and a dark
+// block, different for each seed.
+func testPattern(w, h int, seed float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	cx, cy, r := int(float64(w)*seed/4), h*2/5, h/5
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := 127 + 60*math.Sin(fx*seed*5+fy*3) + 60*math.Cos(fy*seed*4-fx*2)
+			c := color.RGBA{uint8(v), uint8(255 - v), uint8(v / 2), 0xff}
+			switch {
+			case (x-cx)*(x-cx)+(y-cy)*(y-cy) < r*r:
+				c = color.RGBA{250, 240, 30, 0xff}
+			case x > w*7/10 && y > h*6/10:
+				c = color.RGBA{20, 20, 90, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestPerceptualHashes(t *testing.T) {
+	orig := testPattern(400, 300, 1)
+	h := ComputeHashes(orig)
+
+	// A smaller copy, re-compressed.
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resize.Resize(160, 0, orig, resize.Lanczos3), &jpeg.Options{Quality: 40}); err != nil {
+		t.Fatal(err)
+	}
+	cimg, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ComputeHashes(cimg)
+	other := ComputeHashes(testPattern(400, 300, 2.7))
+
+	for _, tt := range []struct {
+		Name         string
+		H, Copy, Oth Hash
+	}{
+		{"ahash", h.AHash, c.AHash, other.AHash},
+		{"dhash", h.DHash, c.DHash, other.DHash},
+		{"phash", h.PHash, c.PHash, other.PHash},
+	} {
+		if d := tt.H.Distance(tt.Copy); d > 6 {
+			t.Errorf("%s: copy too far: %d", tt.Name, d)
+		}
+		if d := tt.H.Distance(tt.Oth); d < 16 {
+			t.Errorf("%s: other image too close: %d", tt.Name, d)
+		}
+	}
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PerceptualHashes
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != h {
+		t.Errorf("unexpected JSON round trip: %s, %+v, %v", data, decoded, err)
+	}
+}
+
+func TestHashIndex(t *testing.T) {
+	x := NewHashIndex()
+	x.Add("banned", PerceptualHashes{PHash: 0xff00ff00ff00ff00})
+	x.Add("close", PerceptualHashes{PHash: 0xff00ff00ff00ff03})
+	x.Add("far", PerceptualHashes{PHash: 0x00ff00ff00ff00ff})
+
+	matches := x.Search(PerceptualHashes{PHash: 0xff00ff00ff00ff01}, 10)
+	expected := []Match{{"banned", 1}, {"close", 1}}
+	if len(matches) != len(expected) || matches[0] != expected[0] || matches[1] != expected[1] {
+		t.Errorf("unexpected matches: %v", matches)
+	}
+
+	x.Remove("banned")
+	if x.Len() != 2 || len(x.Search(PerceptualHashes{PHash: 0xff00ff00ff00ff00}, 0)) != 0 {
+		t.Errorf("image not removed")
+	}
+}
+
+func TestUploadHashes(t *testing.T) {
+	u := New(WithStorage(NewMemoryStorage()), WithPerceptualHashes(true))
+	res, err := u.Save(bytes.NewReader(testJPGImage), "me.jpg", "/", "testID", Rendition{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Hashes == nil {
+		t.Fatal("missing hashes")
+	}
+
+	res, err = New(WithStorage(NewMemoryStorage())).Save(bytes.NewReader(testJPGImage), "me.jpg", "/", "testID", Rendition{})
+	if err != nil || res.Hashes != nil {
+		t.Errorf("unexpected hashes without the option: %v, %v", res.Hashes, err)
+	}
+}
@@ -0,0 +1,52 @@
+package imageupload
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrNoRenditions is returned by UploadRenditions when the Uploader has none configured.
+var ErrNoRenditions = errors.New("no renditions configured")
+
+// Rendition is a named variant of an uploaded image, such as a thumbnail.
+// Width and Height are in pixels, a missing one is computed from the other keeping
+// the aspect ratio. Fit tells how the image is resized when both are set,
+// FitContain by default, and Gravity which part is kept when it is cropped.
+type Rendition struct {
+	Name    string
+	Width   uint
+	Height  uint
+	Fit     Fit
+	Gravity Gravity
+}
+
+// WithRenditions sets the variants produced by UploadRenditions.
+func WithRenditions(renditions ...Rendition) Option {
+	return func(u *Uploader) { u.renditions = renditions }
+}
+
+// UploadRenditions reads the picture from the multi-part form of r, decodes it once and
+// saves every configured rendition under location. Each rendition is named after
+// ID + "_" + its name, ex: 42_thumb.jpg. It returns the saved paths by rendition name.
+func (u *Uploader) UploadRenditions(r *http.Request, location string, ID string) (map[string]string, error) {
+	if len(u.renditions) == 0 {
+		return nil, ErrNoRenditions
+	}
+
+	file, ext, err := u.formFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	res, err := u.process(file, ext, location, ID, u.renditions, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]string, len(res.Files))
+	for name, f := range res.Files {
+		paths[name] = f.Path
+	}
+	return paths, nil
+}
@@ -0,0 +1,56 @@
+package imageupload
+
+import (
+	"image/jpeg"
+	"testing"
+)
+
+func TestUploadRenditions(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(
+		WithStorage(storage),
+		WithRenditions(Rendition{Name: "thumb", Width: 16}, Rendition{Name: "card", Width: 64}),
+	)
+
+	paths, err := u.UploadRenditions(newUploadRequest(t, "get_picture", "me.jpg", testJPGImage), "/users/", "testID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct {
+		path  string
+		width int
+	}{
+		"thumb": {"/users/testID_thumb.jpg", 16},
+		"card":  {"/users/testID_card.jpg", 64},
+	}
+	if len(paths) != len(expected) {
+		t.Fatalf("unexpected renditions: %v", paths)
+	}
+	for name, e := range expected {
+		if paths[name] != e.path {
+			t.Errorf("invalid path for %s, expected: %s, got: %s", name, e.path, paths[name])
+			continue
+		}
+		rc, err := storage.Get(e.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := jpeg.Decode(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := img.Bounds().Dx(); w != e.width {
+			t.Errorf("invalid width for %s, expected: %d, got: %d", name, e.width, w)
+		}
+	}
+}
+
+func TestUploadRenditionsUnconfigured(t *testing.T) {
+	u := New(WithStorage(NewMemoryStorage()))
+	_, err := u.UploadRenditions(newUploadRequest(t, "get_picture", "me.jpg", testJPGImage), "/", "testID")
+	if err != ErrNoRenditions {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package imageupload
+
+import "image"
+
+// Result describes an upload once saved.
+type Result struct {
+	// Format is the name of the format detected in the upload.
+	Format string `json:"format"`
+	// Files are the saved files by rendition name.
+	Files map[string]SavedFile `json:"files"`
+	// Metadata reports the metadata found in the upload and what was kept of it.
+	Metadata MetadataReport `json:"metadata"`
+	// Hashes are the perceptual hashes of the upload, see WithPerceptualHashes.
+	Hashes *PerceptualHashes `json:"hashes,omitempty"`
+}
+
+// SavedFile describes a file written to storage.
+type SavedFile struct {
+	Path string `json:"path"`
+	// Width and Height are the dimensions of the saved image, in pixels.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Bytes is the size of the saved file.
+	Bytes int64 `json:"bytes"`
+	// Format is the name of the format the file is encoded in.
+	Format string `json:"format"`
+	// Crop is the part of the upload kept when the rendition is cropped, nil otherwise.
+	Crop *Rect `json:"crop,omitempty"`
+	// Duplicate tells that the same file was already stored, see WithContentAddressing.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// Rect is a rectangle of an image, in pixels from its top left corner.
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// newRect returns r as a Rect, nil when it is empty.
+func newRect(r image.Rectangle) *Rect {
+	if r.Empty() {
+		return nil
+	}
+	return &Rect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
@@ -0,0 +1,461 @@
+package imageupload
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minPartSize is the smallest part S3 accepts in a multipart upload, except for the last one.
+const minPartSize = 5 << 20
+
+// S3Storage implements Storage on an S3 compatible object store such as AWS S3 or MinIO.
+// Requests are signed with AWS Signature Version 4.
+type S3Storage struct {
+	// Endpoint is the base URL of the service, ex: https://s3.eu-west-1.amazonaws.com
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// PathStyle addresses the bucket as Endpoint/Bucket/key instead of Bucket.Endpoint/key.
+	PathStyle bool
+	// ACL is sent as the canned x-amz-acl of new objects when set, ex: public-read
+	ACL string
+	// ContentType overrides the type guessed from the object name extension.
+	ContentType string
+	// PartSize is the size from which objects are sent with a multipart upload,
+	// and the size of every part. Values below 5MB are raised to 5MB.
+	PartSize int64
+
+	Client *http.Client
+
+	now func() time.Time
+}
+
+// S3Error is returned when the service answers with an unexpected status.
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// NewS3Storage returns an S3Storage using virtual-host addressing and the default HTTP client.
+func NewS3Storage(endpoint, region, bucket, accessKey, secretKey string) *S3Storage {
+	return &S3Storage{
+		Endpoint:  endpoint,
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}
+}
+
+// URL returns the address of the object stored under name.
+func (s *S3Storage) URL(name string) string {
+	return s.objectURL(cleanName(name), nil).String()
+}
+
+// Put implements Storage. Content larger than PartSize is sent as a multipart upload.
+func (s *S3Storage) Put(name string, r io.Reader) error {
+	key := cleanName(name)
+	partSize := s.partSize()
+
+	first, err := io.ReadAll(io.LimitReader(r, partSize))
+	if err != nil {
+		return err
+	}
+	if int64(len(first)) < partSize {
+		return s.putObject(key, first)
+	}
+	return s.putMultipart(key, first, r)
+}
+
+// Get implements Storage.
+func (s *S3Storage) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, cleanName(name), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s.error("get", name, resp)
+	}
+	return resp.Body, nil
+}
+
+// Delete implements Storage.
+func (s *S3Storage) Delete(name string) error {
+	// S3 reports success for missing keys, check first to honour the Storage contract.
+	if _, err := s.Stat(name); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodDelete, cleanName(name), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s.error("delete", name, resp)
+	}
+	return nil
+}
+
+// Stat implements Storage.
+func (s *S3Storage) Stat(name string) (ObjectInfo, error) {
+	key := cleanName(name)
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ObjectInfo{}, s.error("stat", name, resp)
+	}
+
+	info := ObjectInfo{Name: key, Size: resp.ContentLength}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info, nil
+}
+
+// List implements Storage.
+func (s *S3Storage) List(prefix string) ([]ObjectInfo, error) {
+	var infos []ObjectInfo
+	var token string
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", cleanPrefix(prefix))
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := s.doXML(http.MethodGet, "", q, nil, &result); err != nil {
+			return nil, err
+		}
+
+		for _, c := range result.Contents {
+			infos = append(infos, ObjectInfo{Name: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return infos, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Storage) putObject(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, nil, s.objectHeader(key), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.error("put", key, resp)
+	}
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *S3Storage) putMultipart(key string, first []byte, r io.Reader) error {
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML(http.MethodPost, key, url.Values{"uploads": {""}}, s.objectHeader(key), &initiated); err != nil {
+		return err
+	}
+
+	parts, err := s.uploadParts(key, initiated.UploadID, first, r)
+	if err != nil {
+		// Best effort, the upload is dropped by the bucket lifecycle otherwise.
+		if resp, aerr := s.do(http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil); aerr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	return s.doXMLBody(http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, body, nil)
+}
+
+func (s *S3Storage) uploadParts(key, uploadID string, buf []byte, r io.Reader) ([]completedPart, error) {
+	var parts []completedPart
+	for number := 1; len(buf) > 0; number++ {
+		q := url.Values{}
+		q.Set("partNumber", strconv.Itoa(number))
+		q.Set("uploadId", uploadID)
+		resp, err := s.do(http.MethodPut, key, q, nil, buf)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, s.error("put", key, resp)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		if buf, err = io.ReadAll(io.LimitReader(r, s.partSize())); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+func (s *S3Storage) objectHeader(key string) http.Header {
+	h := http.Header{}
+	contentType := s.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	if s.ACL != "" {
+		h.Set("X-Amz-Acl", s.ACL)
+	}
+	return h
+}
+
+func (s *S3Storage) partSize() int64 {
+	if s.PartSize < minPartSize {
+		return minPartSize
+	}
+	return s.PartSize
+}
+
+// doXML sends a request without a body and decodes the XML answer into v when not nil.
+func (s *S3Storage) doXML(method, key string, q url.Values, h http.Header, v interface{}) error {
+	resp, err := s.do(method, key, q, h, nil)
+	if err != nil {
+		return err
+	}
+	return s.decodeXML(key, resp, v)
+}
+
+func (s *S3Storage) doXMLBody(method, key string, q url.Values, body []byte, v interface{}) error {
+	h := http.Header{}
+	h.Set("Content-Type", "application/xml")
+	resp, err := s.do(method, key, q, h, body)
+	if err != nil {
+		return err
+	}
+	return s.decodeXML(key, resp, v)
+}
+
+func (s *S3Storage) decodeXML(key string, resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.error(strings.ToLower(resp.Request.Method), key, resp)
+	}
+	if v == nil {
+		return nil
+	}
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// error turns an unsuccessful response into an error, missing objects wrap os.ErrNotExist.
+func (s *S3Storage) error(op, name string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	e := &S3Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Code    string
+		Message string
+	}
+	if xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body) == nil {
+		e.Code, e.Message = body.Code, body.Message
+	}
+	return e
+}
+
+func (s *S3Storage) do(method, key string, q url.Values, h http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key, q).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	s.sign(req, body)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func (s *S3Storage) objectURL(key string, q url.Values) *url.URL {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		u = &url.URL{Scheme: "https", Host: s.Endpoint}
+	}
+	p := "/" + key
+	if s.PathStyle {
+		p = "/" + s.Bucket + p
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + p
+	u.RawPath = strings.TrimSuffix(u.RawPath, "/") + uriEncode(p, false)
+	if u.RawPath == u.Path {
+		u.RawPath = ""
+	}
+	u.RawQuery = canonicalQuery(q)
+	return u
+}
+
+// sign adds the AWS Signature Version 4 headers to req.
+func (s *S3Storage) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	signedHeaders, canonical := canonicalRequest(req, hex.EncodeToString(payload[:]))
+	hashed := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalRequest returns the signed header list and the canonical form of req.
+func canonicalRequest(req *http.Request, payloadHash string) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var ch strings.Builder
+	for _, k := range names {
+		ch.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery,
+		ch.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	return signed, canonical
+}
+
+// canonicalQuery encodes q sorted by key, as required both on the wire and for signing.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters,
+// and slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
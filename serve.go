@@ -0,0 +1,252 @@
+package imageupload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/gif"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the ServeHandler.
+const (
+	DefaultCacheControl = "public, max-age=86400"
+	DefaultMaxServeSize = 4096
+)
+
+// ServeHandler is an http.Handler serving the images saved under Location by ID,
+// the last element of the URL path by default. It is meant to be mounted with
+// http.StripPrefix, ex: GET /images/42?w=128&h=128&fit=contain&format=png
+//
+// Images are served as stored without query, or resized on the fly to the w by h
+// box following fit and gravity, see Fit and Gravity, and encoded in format, the
+// stored one by default. Responses carry ETag, Last-Modified and Cache-Control headers and
+// support conditional and Range requests.
+type ServeHandler struct {
+	// Uploader saved the images, the default one when nil.
+	Uploader *Uploader
+	// Location is where the images are saved. Ex: /users/images/
+	Location string
+	// ID returns the ID of the image requested by r.
+	ID func(r *http.Request) string
+	// CacheControl is the Cache-Control header of responses, DefaultCacheControl when empty.
+	CacheControl string
+	// MaxSize is the largest width or height served, DefaultMaxServeSize when 0.
+	MaxSize uint
+	// Cache keeps the resized images when set, so each is rendered only once.
+	Cache *Cache
+}
+
+// NewServeHandler returns a ServeHandler serving the images saved under location with u.
+func NewServeHandler(u *Uploader, location string) *ServeHandler {
+	return &ServeHandler{Uploader: u, Location: location}
+}
+
+// variant is a resized version of an image requested by query
+type variant struct {
+	width, height uint
+	fit           Fit
+	gravity       Gravity
+	format        string
+}
+
+func (h *ServeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := h.Uploader
+	if u == nil {
+		u = defaultUploader
+	}
+	id := path.Base(r.URL.Path)
+	if h.ID != nil {
+		id = h.ID(r)
+	}
+	if validateID(id) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	v, err := h.parseVariant(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name, f, info, err := u.find(h.Location, id)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// The tag of a variant depends on both the stored image and the query. The stored
+	// image is told by its name, size and modification time, so it is not read for
+	// requests answered from the client's or our cache.
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%d\x00%d", name, info.Size, info.ModTime.UnixNano())
+	if v != (variant{}) {
+		fmt.Fprintf(hash, "\x00%dx%d/%s/%s/%s", v.width, v.height, v.fit, v.gravity, v.format)
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	// Skip reading and resizing when the client already has this version.
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		h.setCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var data []byte
+	if v == (variant{}) {
+		data, err = u.read(name)
+	} else {
+		render := func() (*cachedImage, error) {
+			data, err := u.read(name)
+			if err != nil {
+				return nil, err
+			}
+			data, f, err := u.render(data, f, v)
+			if err != nil {
+				return nil, err
+			}
+			return &cachedImage{data: data, format: f.Name}, nil
+		}
+		var img *cachedImage
+		if h.Cache != nil {
+			// The tag covers both the stored image and the query.
+			img, err = h.Cache.get(id, etag, render)
+		} else {
+			img, err = render()
+		}
+		if err == nil {
+			data = img.data
+			f, _ = LookupFormat(img.format)
+			name = strings.TrimSuffix(name, path.Ext(name)) + "." + f.ext()
+		}
+	}
+	if err != nil {
+		// Errors are neither cached nor detailed to clients, unless theirs.
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted since found.
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, ErrFileNotSupported) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.setCacheHeaders(w, etag)
+	if len(f.MIMETypes) > 0 {
+		w.Header().Set("Content-Type", f.MIMETypes[0])
+	}
+	http.ServeContent(w, r, path.Base(name), info.ModTime, bytes.NewReader(data))
+}
+
+// setCacheHeaders sets the ETag and Cache-Control headers of a successful response.
+func (h *ServeHandler) setCacheHeaders(w http.ResponseWriter, etag string) {
+	cacheControl := h.CacheControl
+	if cacheControl == "" {
+		cacheControl = DefaultCacheControl
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+}
+
+// parseVariant reads the variant requested by the query of r.
+func (h *ServeHandler) parseVariant(r *http.Request) (variant, error) {
+	maxSize := h.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxServeSize
+	}
+
+	q := r.URL.Query()
+	v := variant{fit: Fit(q.Get("fit")), gravity: Gravity(q.Get("gravity")), format: q.Get("format")}
+	for _, p := range []struct {
+		key string
+		dst *uint
+	}{{"w", &v.width}, {"h", &v.height}} {
+		s := q.Get(p.key)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || uint(n) > maxSize {
+			return variant{}, errors.New("invalid " + p.key + ": " + s)
+		}
+		*p.dst = uint(n)
+	}
+	if !validFit(v.fit) {
+		return variant{}, errors.New("invalid fit: " + string(v.fit))
+	}
+	if !validGravity(v.gravity) {
+		return variant{}, errors.New("invalid gravity: " + string(v.gravity))
+	}
+	return v, nil
+}
+
+// read returns the content of the stored file name.
+func (u *Uploader) read(name string) ([]byte, error) {
+	rc, err := u.storage.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// render decodes data, an image in format f, and encodes it resized to the variant v.
+func (u *Uploader) render(data []byte, f Format, v variant) ([]byte, Format, error) {
+	d, err := u.decode(bytes.NewReader(data), f.ext())
+	if err != nil {
+		return nil, Format{}, err
+	}
+	name := v.format
+	if name == "" {
+		name = KeepFormat
+	}
+	out, ok := resolveFormat(name, d.img, d.format)
+	if !ok {
+		return nil, Format{}, fmt.Errorf("%w: cannot encode %q", ErrFileNotSupported, v.format)
+	}
+
+	plan := planFit(d.img, v.width, v.height, v.fit, v.gravity, u.upscale)
+	var buf bytes.Buffer
+	if out.Name == GIF && d.anim != nil {
+		err = gif.EncodeAll(&buf, resizeGIF(d.anim, plan, u.filter))
+	} else {
+		err = out.Encode(&buf, plan.apply(d.img, u.filter), &EncodeOptions{Quality: u.quality})
+	}
+	if err != nil {
+		return nil, Format{}, err
+	}
+	return buf.Bytes(), out, nil
+}
+
+// etagMatch reports whether the If-None-Match header value lists etag.
+func etagMatch(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
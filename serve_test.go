@@ -0,0 +1,116 @@
+package imageupload
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeHandler(t *testing.T) {
+	storage := NewMemoryStorage()
+	u := New(WithStorage(storage), WithFormat(KeepFormat))
+	if _, err := u.save(bytes.NewReader(testPNGImage(t)), "/users/", "42", "png", 0); err != nil {
+		t.Fatal(err)
+	}
+	h := http.StripPrefix("/images/", NewServeHandler(u, "/users/"))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/images/42", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+	stored := w.Body.Bytes()
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") == "" || w.Header().Get("Cache-Control") != DefaultCacheControl {
+		t.Errorf("missing cache headers: %v", w.Header())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/images/42", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("unexpected status for conditional request: %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/images/42", nil)
+	r.Header.Set("Range", "bytes=0-3")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), stored[:4]) {
+		t.Errorf("unexpected range response: %d %q", w.Code, w.Body.Bytes())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/images/42?w=2&h=1&fit=fill", nil))
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Errorf("unexpected bounds: %v", img.Bounds())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/images/42?w=2&format=jpeg", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("unexpected response: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestServeHandlerErrors(t *testing.T) {
+	u := New(WithStorage(NewMemoryStorage()))
+	if _, err := u.save(bytes.NewReader(testJPGImage), "/", "42", "jpg", 0); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServeHandler(u, "/")
+
+	testTable := []struct {
+		Method, URL string
+		Status      int
+	}{
+		{http.MethodGet, "/43", http.StatusNotFound},
+		{http.MethodGet, "/42?w=abc", http.StatusBadRequest},
+		{http.MethodGet, "/42?w=100000", http.StatusBadRequest},
+		{http.MethodGet, "/42?fit=zoom", http.StatusBadRequest},
+		{http.MethodGet, "/42?format=tiff", http.StatusBadRequest},
+		{http.MethodPost, "/42", http.StatusMethodNotAllowed},
+		{http.MethodHead, "/42", http.StatusOK},
+	}
+
+	for _, tt := range testTable {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.Method, tt.URL, nil))
+		if w.Code != tt.Status {
+			t.Errorf("%s %s: unexpected status: %d, expected: %d", tt.Method, tt.URL, w.Code, tt.Status)
+		}
+	}
+}
+
+func TestServeHandlerRenderError(t *testing.T) {
+	storage := NewMemoryStorage()
+	data := testJPGImage[:len(testJPGImage)/2]
+	if err := storage.Put("/42.jpg", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	h := NewServeHandler(New(WithStorage(storage)), "/")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/42?w=10", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	if w.Header().Get("Cache-Control") != "" || w.Header().Get("ETag") != "" {
+		t.Errorf("error cacheable: %v", w.Header())
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("error detailed to the client: %q", body)
+	}
+}
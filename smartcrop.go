@@ -0,0 +1,128 @@
+package imageupload
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// GravitySmart keeps the part of the image with the most edges and details,
+// which is usually where the subject of a photo is.
+const GravitySmart Gravity = "smart"
+
+// smartLen is the size of the longest side of the image analysed by GravitySmart.
+const smartLen = 128
+
+// smartOffset returns the offset within b of the window of width by height pixels
+// with the highest edge density, weighted by the entropy of its luminance.
+// The search runs on a small copy of img, windows are then mapped back to b.
+func smartOffset(img image.Image, b image.Rectangle, width, height int) (int, int) {
+	freeX, freeY := b.Dx()-width, b.Dy()-height
+	if freeX == 0 && freeY == 0 {
+		return 0, 0
+	}
+
+	src := img
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		src = sub.SubImage(b)
+	}
+	small := resize.Thumbnail(smartLen, smartLen, src, resize.Bilinear)
+	sb := small.Bounds()
+	scale := float64(sb.Dx()) / float64(b.Dx())
+
+	lum := luminance(small)
+	edges := integral(edgeMap(lum, sb.Dx(), sb.Dy()), sb.Dx(), sb.Dy())
+
+	ww := clamp(int(math.Round(float64(width)*scale)), 1, sb.Dx())
+	wh := clamp(int(math.Round(float64(height)*scale)), 1, sb.Dy())
+	sfreeX, sfreeY := sb.Dx()-ww, sb.Dy()-wh
+	stepX, stepY := maxInt(1, sfreeX/entropySteps), maxInt(1, sfreeY/entropySteps)
+
+	bestX, bestY, best := sfreeX/2, sfreeY/2, -1.0
+	for y := 0; y <= sfreeY; y += stepY {
+		for x := 0; x <= sfreeX; x += stepX {
+			density := float64(edges.sum(x, y, ww, wh)) / float64(ww*wh)
+			window := image.Rect(x, y, x+ww, y+wh).Add(sb.Min)
+			score := density * (1 + entropy(small, window)/8)
+			// Prefer central windows on equal scores, subjects are rarely on the edge.
+			dx := float64(x-sfreeX/2) / float64(maxInt(1, sfreeX))
+			dy := float64(y-sfreeY/2) / float64(maxInt(1, sfreeY))
+			score *= 1 - 0.1*math.Sqrt(dx*dx+dy*dy)
+			if score > best {
+				bestX, bestY, best = x, y, score
+			}
+		}
+	}
+
+	x := clamp(int(math.Round(float64(bestX)/scale)), 0, freeX)
+	y := clamp(int(math.Round(float64(bestY)/scale)), 0, freeY)
+	return x, y
+}
+
+// luminance returns the luminance of every pixel of img, row by row.
+func luminance(img image.Image) []uint8 {
+	b := img.Bounds()
+	lum := make([]uint8, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			lum = append(lum, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return lum
+}
+
+// edgeMap returns the gradient magnitude of the w by h luminance lum, as the sum
+// of its absolute horizontal and vertical central differences.
+func edgeMap(lum []uint8, w, h int) []int {
+	edges := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			l, r := lum[y*w+maxInt(x-1, 0)], lum[y*w+minInt(x+1, w-1)]
+			t, bt := lum[maxInt(y-1, 0)*w+x], lum[minInt(y+1, h-1)*w+x]
+			edges[y*w+x] = absInt(int(r)-int(l)) + absInt(int(bt)-int(t))
+		}
+	}
+	return edges
+}
+
+// summedArea is an integral image, giving the sum of any rectangle in constant time.
+type summedArea struct {
+	w    int
+	sums []int
+}
+
+// integral returns the summed area table of the w by h values v.
+func integral(v []int, w, h int) summedArea {
+	s := summedArea{w: w + 1, sums: make([]int, (w+1)*(h+1))}
+	for y := 0; y < h; y++ {
+		row := 0
+		for x := 0; x < w; x++ {
+			row += v[y*w+x]
+			s.sums[(y+1)*s.w+x+1] = s.sums[y*s.w+x+1] + row
+		}
+	}
+	return s
+}
+
+// sum returns the sum of the values in the w by h rectangle at x, y.
+func (s summedArea) sum(x, y, w, h int) int {
+	return s.sums[(y+h)*s.w+x+w] - s.sums[y*s.w+x+w] - s.sums[(y+h)*s.w+x] + s.sums[y*s.w+x]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package imageupload
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testSubject returns a flat 300x100 image with a checkered subject at x 20 to 80.
+func testSubject() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			c := color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+			if x >= 20 && x < 80 && y >= 20 && y < 80 && (x/4+y/4)%2 == 0 {
+				c = color.RGBA{0x20, 0x40, 0x60, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestSmartCrop(t *testing.T) {
+	img := testSubject()
+	subject := image.Rect(20, 20, 80, 80)
+
+	p := planFit(img, 50, 50, FitCover, GravitySmart, true)
+	if !subject.Overlaps(p.source) || p.source.Min.X > 20 {
+		t.Errorf("subject missed by the smart crop: %v", p.source)
+	}
+	if p := planFit(img, 100, 100, FitCrop, GravitySmart, true); !subject.In(p.source) {
+		t.Errorf("subject not within the smart crop: %v", p.source)
+	}
+	if p := planFit(img, 100, 100, FitCover, GravityCenter, true); p.source.Overlaps(subject) {
+		t.Errorf("unexpected center crop: %v", p.source)
+	}
+}
+
+func TestSmartCropResult(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testSubject()); err != nil {
+		t.Fatal(err)
+	}
+
+	u := New(WithStorage(NewMemoryStorage()))
+	res, err := u.Save(bytes.NewReader(buf.Bytes()), "me.png", "/", "testID",
+		Rendition{Name: "thumb", Width: 50, Height: 50, Fit: FitCover, Gravity: GravitySmart},
+		Rendition{Name: "full"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crop := res.Files["thumb"].Crop
+	if crop == nil || crop.Width != 100 || crop.Height != 100 || crop.X > 20 {
+		t.Errorf("unexpected crop: %+v", crop)
+	}
+	if res.Files["full"].Crop != nil {
+		t.Errorf("unexpected crop without cropping: %+v", res.Files["full"].Crop)
+	}
+}
+
+func TestIntegral(t *testing.T) {
+	v := []int{
+		1, 2, 3,
+		4, 5, 6,
+	}
+	s := integral(v, 3, 2)
+	if got := s.sum(0, 0, 3, 2); got != 21 {
+		t.Errorf("unexpected sum of all: %d", got)
+	}
+	if got := s.sum(1, 1, 2, 1); got != 11 {
+		t.Errorf("unexpected sum of 5 and 6: %d", got)
+	}
+}
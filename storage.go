@@ -0,0 +1,60 @@
+package imageupload
+
+import (
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Storage is where an Uploader writes images to. Names are slash separated
+// keys such as "users/images/42.jpg", a leading slash is ignored.
+// Missing objects are reported with errors satisfying errors.Is(err, os.ErrNotExist).
+type Storage interface {
+	// Put stores the content of r under name, replacing any previous object.
+	// It is atomic: readers see the previous object or the whole new one, never
+	// a partial write, and nothing is stored when it fails.
+	Put(name string, r io.Reader) error
+	// Get opens the object stored under name, the caller must close it.
+	Get(name string) (io.ReadCloser, error)
+	// Delete removes the object stored under name.
+	Delete(name string) error
+	// Stat describes the object stored under name.
+	Stat(name string) (ObjectInfo, error)
+	// List describes every object whose name starts with prefix, sorted by name.
+	List(prefix string) ([]ObjectInfo, error)
+}
+
+// DirCreator is implemented by storages which need a directory to exist before
+// storing objects in it, such as DiskStorage. Uploaders sharding their files call
+// it to create the shard directories, see WithSharding. Storages wrapping a
+// DiskStorage implement it by forwarding the call.
+type DirCreator interface {
+	// CreateDir creates the directory name, its parent must exist.
+	// It succeeds when the directory already exists.
+	CreateDir(name string) error
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// cleanName turns name into the canonical form used as a storage key.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// cleanPrefix is cleanName for List prefixes, keeping a trailing slash meaningful.
+func cleanPrefix(prefix string) string {
+	if prefix == "" || prefix == "/" {
+		return ""
+	}
+	p := cleanName(prefix)
+	if strings.HasSuffix(prefix, "/") {
+		p += "/"
+	}
+	return p
+}
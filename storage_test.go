@@ -0,0 +1,73 @@
+package imageupload
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "users", "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	backends := map[string]Storage{
+		"disk":   NewDiskStorage(root),
+		"memory": NewMemoryStorage(),
+	}
+	for name, s := range backends {
+		t.Run(name, func(t *testing.T) { testStorage(t, s) })
+	}
+}
+
+func testStorage(t *testing.T, s Storage) {
+	if err := s.Put("/users/images/a.jpg", strings.NewReader("aaa")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("users/images/b.jpg", strings.NewReader("bb")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("users/c.jpg", strings.NewReader("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := s.Get("users/images/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != "aaa" {
+		t.Errorf("unexpected content: %q, %v", data, err)
+	}
+
+	info, err := s.Stat("/users/images/b.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "users/images/b.jpg" || info.Size != 2 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	infos, err := s.List("users/images/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "users/images/a.jpg" || infos[1].Name != "users/images/b.jpg" {
+		t.Errorf("unexpected listing: %+v", infos)
+	}
+
+	if err := s.Delete("users/images/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("users/images/a.jpg"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist error, got: %v", err)
+	}
+	if _, err := s.Get("users/images/a.jpg"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist error, got: %v", err)
+	}
+}
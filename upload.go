@@ -1,139 +1,291 @@
 package imageupload
 
 import (
-	"errors"
+	"bufio"
+	"bytes"
+	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/gif"
-	"image/jpeg"
-	"image/png"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"strings"
-
-	"github.com/nfnt/resize"
 )
 
-var extMap map[string]int
-
-var fs fileSystem = osFS{}
-
-var ErrFileNotSupported = errors.New("file is not an image")
-
-func init() {
-	initExtMap()
-}
-
 // UploadFile function is a simple helper function that uploads and saves an image on the server
 // Params:
 // r: to get the picture from multi-part form using key "get_picture"
 // location: the path on server where you wish to save file. Ex: /users/images/
 // ID: unique string ID for the image
 // size: to resize the image, the function will keep the aspect ratio intact
+// It fails with ErrNoFile when the form holds no picture, see errors.go for the others.
 func UploadFile(r *http.Request, location string, ID string, size uint) (string, error) {
-	var path string
-	file, hdr, err := r.FormFile("get_picture")
+	return defaultUploader.Upload(r, location, ID, size)
+}
+
+// Upload reads the picture from the multi-part form of r and saves it under location,
+// named after ID and resized to size pixels wide. It returns the path of the saved file.
+func (u *Uploader) Upload(r *http.Request, location string, ID string, size uint) (string, error) {
+	file, ext, err := u.formFile(r)
 	if err != nil {
-		return path, nil
+		return "", err
 	}
-
-	ext := getExt(hdr.Filename)
 	defer file.Close()
 
-	path, err = saveFile(file, location, ID, ext, size)
+	return u.save(file, location, ID, ext, size)
+}
+
+// UploadResult reads the picture from the multi-part form of r and saves the given
+// renditions of it, or the configured ones when none is given, like Save does.
+// When the form has crop fields, see CropXField, the picture is cropped first.
+func (u *Uploader) UploadResult(r *http.Request, location string, ID string, renditions ...Rendition) (*Result, error) {
+	if len(renditions) == 0 {
+		renditions = u.renditions
+	}
+	if len(renditions) == 0 {
+		return nil, ErrNoRenditions
+	}
+
+	file, ext, err := u.formFile(r)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	defer file.Close()
 
-	return path, nil
+	crop, err := formCrop(r)
+	if err != nil {
+		return nil, err
+	}
+	return u.process(file, ext, location, ID, renditions, crop)
 }
 
-// SaveFile function helps in uploading the profile picture of user
-func saveFile(src io.Reader, location, ID, ext string, size uint) (string, error) {
-	name := ID + ".jpg"
-	path := "." + location + name
-	var img image.Image
-	var op jpeg.Options
-	var err error
-	op.Quality = 50
+// Save decodes src and saves every given rendition of it under location. filename is
+// the name the client gave the file, its extension is only used as a format hint.
+// A rendition without name is named after ID, the others after ID + "_" + their name.
+func (u *Uploader) Save(src io.Reader, filename, location, ID string, renditions ...Rendition) (*Result, error) {
+	return u.process(src, getExt(filename), location, ID, renditions, nil)
+}
 
-	e, ok := extMap[ext]
-	if !ok {
-		return "", ErrFileNotSupported
+// formFile opens the picture of the multi-part form of r and returns its extension.
+// The body of r is limited to the maximum upload size, ErrUploadTooLarge is
+// returned past it and the form is kept in memory up to the maximum memory.
+func (u *Uploader) formFile(r *http.Request) (multipart.File, string, error) {
+	if err := u.limitBody(r); err != nil {
+		return nil, "", err
 	}
-
-	switch e {
-	case JPG:
-		img, err = decodeJPG(src, size)
-		if err != nil {
-			return "", err
-		}
-	case PNG:
-		img, err = decodePNG(src, size)
-		if err != nil {
-			return "", err
-		}
-	case GIF:
-		img, err = decodeGIF(src, size)
-		if err != nil {
-			return "", err
+	if err := r.ParseMultipartForm(u.maxMemory); err != nil {
+		if err = uploadError(err); err == ErrUploadTooLarge {
+			return nil, "", err
 		}
+		return nil, "", fmt.Errorf("%w: %v", ErrMalformedMultipart, err)
+	}
+	file, hdr, err := r.FormFile(u.field)
+	if err == http.ErrMissingFile {
+		return nil, "", ErrNoFile
 	}
+	if err != nil {
+		return nil, "", err
+	}
+	// The extension is only a hint, decode sniffs the content to pick a decoder.
+	return file, getExt(hdr.Filename), nil
+}
 
-	dst, err := fs.Create(path)
+// decoded is an upload once decoded
+type decoded struct {
+	img    image.Image
+	format Format
+	// anim holds every frame of animated GIFs, img is then the first one.
+	anim *gif.GIF
+	meta *metadata
+	// rotated tells whether img was turned upright according to its EXIF orientation.
+	rotated bool
+	// crop is the part of img kept, relative to its top left corner, all of it when empty.
+	crop image.Rectangle
+}
+
+// save decodes src, resizes it and writes it to the uploader's storage
+func (u *Uploader) save(src io.Reader, location, ID, ext string, size uint) (string, error) {
+	res, err := u.process(src, ext, location, ID, []Rendition{{Width: size}}, nil)
 	if err != nil {
 		return "", err
 	}
-	defer dst.Close()
+	return res.Files[""].Path, nil
+}
 
-	if err := jpeg.Encode(dst, img, &op); err != nil {
-		return "", err
+// process decodes src once, cuts crop out of it when set and stores every rendition of it
+func (u *Uploader) process(src io.Reader, ext, location, ID string, renditions []Rendition, crop *Crop) (*Result, error) {
+	d, err := u.decode(src, ext)
+	if err != nil {
+		return nil, err
+	}
+	if crop != nil {
+		if d.crop, err = crop.rect(d.img.Bounds()); err != nil {
+			return nil, err
+		}
 	}
 
-	path = location + name
-	return path, err
+	res := &Result{Format: d.format.Name, Files: make(map[string]SavedFile, len(renditions))}
+	if u.hashes {
+		h := ComputeHashes(d.img)
+		res.Hashes = &h
+	}
+	for _, rd := range renditions {
+		name := ID
+		if rd.Name != "" {
+			name += "_" + rd.Name
+		}
+		file, report, err := u.store(d, location, name, rd)
+		if err != nil {
+			return nil, err
+		}
+		res.Files[rd.Name] = file
+		res.Metadata = report
+	}
+	return res, nil
 }
 
-// DecodeJPG function decodes JPG image
-func decodeJPG(src io.Reader, size uint) (image.Image, error) {
-	img, err := jpeg.Decode(src)
+// decode sniffs the format of src and decodes it
+func (u *Uploader) decode(src io.Reader, ext string) (*decoded, error) {
+	br := bufio.NewReader(src)
+	f, err := detectFormat(br, ext)
 	if err != nil {
 		return nil, err
 	}
-	return resize.Resize(size, 0, img, resize.Lanczos3), nil
-}
 
-// DecodePNG function decodes PNG image
-func decodePNG(src io.Reader, size uint) (image.Image, error) {
-	img, err := png.Decode(src)
+	// Keep the whole file around to read its metadata.
+	data, err := io.ReadAll(br)
 	if err != nil {
 		return nil, err
 	}
-	return resize.Resize(size, 0, img, resize.Lanczos3), nil
+	// Reject decompression bombs from their header, before allocating the pixels.
+	if err := u.checkLimits(f, data); err != nil {
+		return nil, err
+	}
+	d := &decoded{format: f, meta: readMetadata(f.Name, data)}
+
+	if f.Name == GIF {
+		// Keep every frame, in case the animation is saved as GIF.
+		g, err := decodeGIF(bytes.NewReader(data))
+		if err != nil {
+			return nil, &DecodeError{Format: f.Name, Err: err}
+		}
+		d.img = g.Image[0]
+		if len(g.Image) > 1 {
+			// Sizes and crops are planned on the whole screen the frames are drawn on.
+			d.img = firstFrame(g)
+			d.anim = g
+		}
+		return d, nil
+	}
+
+	if d.img, err = f.Decode(bytes.NewReader(data)); err != nil {
+		return nil, &DecodeError{Format: f.Name, Err: err}
+	}
+	if f.Name == JPG && u.autoOrient {
+		// Phones store photos in sensor orientation, the EXIF tag tells how to turn them upright.
+		if o := d.meta.orientation(); o > 1 && o <= 8 {
+			d.img = applyOrientation(d.img, o)
+			d.rotated = true
+		}
+	}
+	return d, nil
 }
 
-// DecodeGIF function decodes GIF image
-func decodeGIF(src io.Reader, size uint) (image.Image, error) {
-	img, err := gif.Decode(src)
+// store resizes d to the rendition rd, encodes it with the metadata kept by the
+// uploader's policy and writes it to the uploader's storage
+func (u *Uploader) store(d *decoded, location, ID string, rd Rendition) (SavedFile, MetadataReport, error) {
+	f, ok := u.outputFormat(d.img, d.format)
+	if !ok {
+		return SavedFile{}, MetadataReport{}, ErrFileNotSupported
+	}
+	src := d.img
+	if !d.crop.Empty() {
+		src = subImage(d.img, d.crop)
+	}
+	plan := planFit(src, rd.Width, rd.Height, rd.Fit, rd.Gravity, u.upscale).after(d.crop)
+	var buf bytes.Buffer
+	var bounds image.Rectangle
+	if f.Name == GIF && d.anim != nil && !u.gifPoster {
+		g := resizeGIF(d.anim, plan, u.filter)
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return SavedFile{}, MetadataReport{}, err
+		}
+		bounds = g.Image[0].Bounds()
+	} else {
+		img := plan.apply(d.img, u.filter)
+		if err := f.Encode(&buf, img, &EncodeOptions{Quality: u.quality}); err != nil {
+			return SavedFile{}, MetadataReport{}, err
+		}
+		bounds = img.Bounds()
+	}
+
+	// Every write goes through here, nothing the policy drops can reach storage.
+	data, report := writeMetadata(f.Name, buf.Bytes(), d.meta, u.metadata, d.rotated)
+	name, duplicate, err := u.put(location, ID, f, data)
 	if err != nil {
-		return nil, err
+		return SavedFile{}, MetadataReport{}, err
+	}
+
+	file := SavedFile{
+		Path:   name,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Bytes:  int64(len(data)),
+		Format: f.Name,
+		Crop:   newRect(plan.source),
+
+		Duplicate: duplicate,
 	}
-	return resize.Resize(size, 0, img, resize.Lanczos3), nil
+	return file, report, nil
 }
 
-func initExtMap() {
-	extMap = make(map[string]int)
+// outputFormat resolves the uploader's format policy for img, decoded from source.
+// It returns false when the resolved format is unknown or cannot be encoded.
+func (u *Uploader) outputFormat(img image.Image, source Format) (Format, bool) {
+	return resolveFormat(u.format, img, source)
+}
 
-	extMap["jpeg"] = JPG
-	extMap["jpg"] = JPG
-	extMap["JPG"] = JPG
-	extMap["JPEG"] = JPG
+// resolveFormat resolves the format name or policy for img, decoded from source.
+func resolveFormat(name string, img image.Image, source Format) (Format, bool) {
+	switch name {
+	case KeepFormat:
+		// Formats we cannot encode, such as WEBP, fall back to AutoFormat.
+		if source.Encode != nil {
+			return source, true
+		}
+		fallthrough
+	case AutoFormat:
+		name = PNG
+		if isOpaque(img) {
+			name = JPG
+		}
+	}
 
-	extMap["png"] = PNG
-	extMap["PNG"] = PNG
+	f, ok := LookupFormat(name)
+	return f, ok && f.Encode != nil
+}
 
-	extMap["gif"] = GIF
-	extMap["GIF"] = GIF
+// isOpaque reports whether img is known to have no transparent pixel
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// flatten draws img over a background of color bg
+func flatten(img image.Image, bg color.Color) image.Image {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// DecodeGIF function decodes every frame of GIF image
+func decodeGIF(src io.Reader) (*gif.GIF, error) {
+	return gif.DecodeAll(src)
 }
 
 func getExt(filename string) string {
@@ -152,17 +304,3 @@ func reverse(txt string) string {
 
 	return string(result)
 }
-
-type fileSystem interface {
-	Create(name string) (file, error)
-}
-
-type file interface {
-	io.Closer
-	io.Writer
-}
-
-// osFS implements fileSystem using the local disk.
-type osFS struct{}
-
-func (osFS) Create(name string) (file, error) { return os.Create(name) }
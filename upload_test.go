@@ -2,45 +2,49 @@ package imageupload
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
 	"strings"
 	"testing"
 )
 
 func init() {
-	initExtMap()
-	fs = dummyFS{}
+	defaultUploader = New(WithStorage(NewMemoryStorage()))
 }
 
 func TestUnknownFormat(t *testing.T) {
-	_, err := saveFile(strings.NewReader("nop"), "/", "testID", "unknown", 0)
-	if err != ErrFileNotSupported {
+	_, err := defaultUploader.save(strings.NewReader("nop"), "/", "testID", "unknown", 0)
+	var fe *FormatError
+	if !errors.As(err, &fe) || fe.Declared != "unknown" || fe.Detected != "" || !errors.Is(err, ErrFileNotSupported) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
 
 func TestJPGDecodeFail(t *testing.T) {
-	_, err := saveFile(strings.NewReader("nop"), "/", "testID", "jpg", 0)
+	_, err := defaultUploader.save(strings.NewReader("nop"), "/", "testID", "jpg", 0)
 	if err == nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
 
 func TestPNGDecodeFail(t *testing.T) {
-	_, err := saveFile(strings.NewReader("nop"), "/", "testID", "png", 0)
+	_, err := defaultUploader.save(strings.NewReader("nop"), "/", "testID", "png", 0)
 	if err == nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
 
 func TestGIFDecodeFail(t *testing.T) {
-	_, err := saveFile(strings.NewReader("nop"), "/", "testID", "gif", 0)
+	_, err := defaultUploader.save(strings.NewReader("nop"), "/", "testID", "gif", 0)
 	if err == nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
 
 func TestJPGHappyPath(t *testing.T) {
-	p, err := saveFile(bytes.NewReader(testJPGImage), "/", "testID", "jpg", 0)
+	p, err := defaultUploader.save(bytes.NewReader(testJPGImage), "/", "testID", "jpg", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -49,6 +53,58 @@ func TestJPGHappyPath(t *testing.T) {
 	}
 }
 
+func TestRenamedPNG(t *testing.T) {
+	p, err := defaultUploader.save(bytes.NewReader(testPNGImage(t)), "/", "testID", "jpg", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/testID.jpg" {
+		t.Errorf("invalid file name, expected: testID.jpg, got: %s", p)
+	}
+}
+
+func TestMismatchedContent(t *testing.T) {
+	_, err := defaultUploader.save(strings.NewReader("MZ\x90\x00"), "/", "testID", "png", 0)
+	var fe *FormatError
+	if !errors.As(err, &fe) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fe.Declared != "png" || fe.Detected != "" {
+		t.Errorf("unexpected formats, declared: %q, detected: %q", fe.Declared, fe.Detected)
+	}
+	if !errors.Is(err, ErrFileNotSupported) {
+		t.Errorf("expected error to wrap ErrFileNotSupported")
+	}
+}
+
+func TestWEBP(t *testing.T) {
+	testTable := []struct {
+		Name  string
+		Input string
+		Path  string
+	}{
+		{"lossy", "UklGRiIAAABXRUJQVlA4IBYAAAAwAQCdASoBAAEADsD+JaQAA3AAAAAA", "/testID.jpg"},
+		{"lossless", "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==", "/testID.png"},
+		{"alpha", "UklGRkoAAABXRUJQVlA4WAoAAAAQAAAAAAAAAAAAQUxQSAwAAAARBxAR/Q9ERP8DAABWUDggGAAAABQBAJ0BKgEAAQAAAP4AAA3AAP7mtQAAAA==", "/testID.png"},
+	}
+
+	u := New(WithFormat(KeepFormat), WithStorage(NewMemoryStorage()))
+	for _, tt := range testTable {
+		data, err := base64.StdEncoding.DecodeString(tt.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := u.save(bytes.NewReader(data), "/", "testID", "webp", 0)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.Name, err)
+			continue
+		}
+		if p != tt.Path {
+			t.Errorf("%s: invalid file name, expected: %s, got: %s", tt.Name, tt.Path, p)
+		}
+	}
+}
+
 func TestGetExt(t *testing.T) {
 	testTable := []struct{
 		Input string
@@ -66,17 +122,14 @@ func TestGetExt(t *testing.T) {
 	}
 }
 
-type dummyFile struct{}
-
-func (dummyFile) Close() error { return nil }
-func (dummyFile) Write(p []byte) (n int, err error) { return len(p), nil}
-
-type dummyFS struct{
-	createFile string
+func testPNGImage(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
 }
 
-func (dummyFS) Create(name string) (file, error) { return dummyFile{}, nil }
-
 var testJPGImage = []byte{
 	0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 0x4a, 0x46, 0x49, 0x46, 0x00, 0x01, 0x01, 0x01, 0x00, 0x60,
 	0x00, 0x60, 0x00, 0x00, 0xff, 0xdb, 0x00, 0x43, 0x00, 0x06, 0x04, 0x05, 0x06, 0x05, 0x04, 0x06,
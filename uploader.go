@@ -0,0 +1,126 @@
+package imageupload
+
+import (
+	"sync"
+
+	"github.com/nfnt/resize"
+)
+
+// Uploader holds the settings used to receive, resize and save images.
+// Build one with New, the zero value is not usable.
+type Uploader struct {
+	field   string
+	format  string
+	quality int
+	filter  resize.InterpolationFunction
+	storage Storage
+	naming  NamingFunc
+
+	renditions []Rendition
+	gifPoster  bool
+	autoOrient bool
+	metadata   MetadataPolicy
+
+	maxWidth, maxHeight int
+	maxPixels           int64
+	maxFrames           int
+
+	maxUploadSize, maxMemory int64
+
+	upscale bool
+
+	overwrite        OverwritePolicy
+	contentAddressed bool
+	hashes           bool
+	shards           int
+	// refsMu serializes the updates of the references of content addressed files.
+	refsMu sync.Mutex
+}
+
+// Option configures an Uploader.
+type Option func(*Uploader)
+
+// NamingFunc returns the file name for an image with the given ID and extension.
+type NamingFunc func(ID, ext string) string
+
+// defaultUploader backs UploadFile and keeps its historical behaviour.
+var defaultUploader = New()
+
+// New returns an Uploader with the default settings overridden by opts.
+func New(opts ...Option) *Uploader {
+	u := &Uploader{
+		field:   "get_picture",
+		format:  JPG,
+		quality: 50,
+		filter:  resize.Lanczos3,
+		storage: NewDiskStorage("."),
+		naming:  defaultNaming,
+
+		autoOrient: true,
+		maxPixels:  DefaultMaxPixels,
+		maxFrames:  DefaultMaxFrames,
+
+		maxUploadSize: DefaultMaxUploadSize,
+		maxMemory:     DefaultMaxMemory,
+
+		upscale: true,
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// WithFieldName sets the multi-part form key the picture is read from.
+func WithFieldName(name string) Option {
+	return func(u *Uploader) { u.field = name }
+}
+
+// WithFormat sets the name of the format images are encoded to, such as JPG, PNG,
+// GIF or any registered format with an encoder, or the KeepFormat and AutoFormat
+// policies. The file extension follows the format.
+func WithFormat(format string) Option {
+	return func(u *Uploader) { u.format = format }
+}
+
+// WithQuality sets the JPEG quality, ranging from 1 to 100.
+func WithQuality(quality int) Option {
+	return func(u *Uploader) { u.quality = quality }
+}
+
+// WithFilter sets the interpolation function used when resizing.
+func WithFilter(filter resize.InterpolationFunction) Option {
+	return func(u *Uploader) { u.filter = filter }
+}
+
+// WithRoot stores images on the local disk, with locations relative to dir.
+// It is a shorthand for WithStorage(NewDiskStorage(dir)).
+func WithRoot(dir string) Option {
+	return WithStorage(NewDiskStorage(dir))
+}
+
+// WithStorage sets where images are written to.
+func WithStorage(storage Storage) Option {
+	return func(u *Uploader) { u.storage = storage }
+}
+
+// WithNaming sets the strategy used to name saved files.
+func WithNaming(naming NamingFunc) Option {
+	return func(u *Uploader) { u.naming = naming }
+}
+
+// WithGIFPoster keeps only the first frame of animated GIFs when set.
+// Animations are always reduced to their first frame when encoding to JPG or PNG.
+func WithGIFPoster(poster bool) Option {
+	return func(u *Uploader) { u.gifPoster = poster }
+}
+
+// WithAutoOrient sets whether JPG images are turned upright according to their EXIF
+// orientation before being resized. It is enabled by default.
+func WithAutoOrient(autoOrient bool) Option {
+	return func(u *Uploader) { u.autoOrient = autoOrient }
+}
+
+func defaultNaming(ID, ext string) string {
+	return ID + "." + ext
+}
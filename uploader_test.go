@@ -0,0 +1,127 @@
+package imageupload
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploaderOptions(t *testing.T) {
+	u := New(
+		WithFormat(PNG),
+		WithNaming(func(ID, ext string) string { return "avatar-" + ID + "." + ext }),
+		WithStorage(NewMemoryStorage()),
+	)
+	p, err := u.save(bytes.NewReader(testJPGImage), "/users/", "testID", "jpg", 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/users/avatar-testID.png" {
+		t.Errorf("invalid file name, expected: /users/avatar-testID.png, got: %s", p)
+	}
+}
+
+func TestUploaderFieldName(t *testing.T) {
+	u := New(WithFieldName("avatar"), WithStorage(NewMemoryStorage()))
+	p, err := u.Upload(newUploadRequest(t, "avatar", "me.jpg", testJPGImage), "/", "testID", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/testID.jpg" {
+		t.Errorf("invalid file name, expected: /testID.jpg, got: %s", p)
+	}
+}
+
+func TestUploaderRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "users"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	u := New(WithRoot(root))
+	p, err := u.save(bytes.NewReader(testJPGImage), "/users/", "testID", "jpg", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "users", "testID.jpg")); err != nil {
+		t.Errorf("file %s not written below root: %v", p, err)
+	}
+}
+
+func TestUploaderFormatPolicy(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, transparent); err != nil {
+		t.Fatal(err)
+	}
+	transparentPNG := buf.Bytes()
+
+	testTable := []struct {
+		Format   string
+		Input    []byte
+		Path     string
+		Detected string
+	}{
+		{KeepFormat, transparentPNG, "/testID.png", "png"},
+		{KeepFormat, testJPGImage, "/testID.jpg", "jpeg"},
+		{AutoFormat, transparentPNG, "/testID.png", "png"},
+		{AutoFormat, testJPGImage, "/testID.jpg", "jpeg"},
+		{JPG, transparentPNG, "/testID.jpg", "jpeg"},
+		{PNG, testJPGImage, "/testID.png", "png"},
+	}
+
+	for _, tt := range testTable {
+		storage := NewMemoryStorage()
+		u := New(WithFormat(tt.Format), WithStorage(storage))
+		p, err := u.save(bytes.NewReader(tt.Input), "/", "testID", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != tt.Path {
+			t.Errorf("invalid file name, expected: %s, got: %s", tt.Path, p)
+			continue
+		}
+		rc, err := storage.Get(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, format, err := image.Decode(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != tt.Detected {
+			t.Errorf("invalid encoding for %s, expected: %s, got: %s", p, tt.Detected, format)
+		}
+		if tt.Format == JPG && tt.Input[0] != 0xff {
+			if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 < 0xf0 || g>>8 < 0xf0 || b>>8 < 0xf0 {
+				t.Errorf("transparent area not flattened on white, got: %v", img.At(0, 0))
+			}
+		}
+	}
+}
+
+func newUploadRequest(t *testing.T, field, filename string, content []byte) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}